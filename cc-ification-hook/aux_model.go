@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var auxClient = &http.Client{Timeout: 120 * time.Second}
+
+func callAuxModel(model *AuxModel, system string, content any) (string, error) {
+	if model.APIType == "anthropic" {
+		return callAnthropicAuxModel(model, system, content)
+	}
+	return callOpenAIAuxModel(model, system, content)
+}
+
+func callOpenAIAuxModel(model *AuxModel, system string, content any) (string, error) {
+	var messages []OpenAIMessage
+	if system != "" {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, OpenAIMessage{Role: "user", Content: content})
+
+	reqBody, err := json.Marshal(OpenAIRequest{
+		Model:     model.Model,
+		Messages:  messages,
+		MaxTokens: model.MaxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, model.URL+"/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+model.APIKey)
+
+	body, err := doAuxRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp OpenAINonStreamResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+func callAnthropicAuxModel(model *AuxModel, system string, content any) (string, error) {
+	reqBody, err := json.Marshal(AnthropicRequest{
+		Model:     model.Model,
+		MaxTokens: model.MaxTokens,
+		System:    system,
+		Messages:  []AnthropicMessage{{Role: "user", Content: content}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, model.URL+"/v1/messages", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", model.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	body, err := doAuxRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp AnthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, block := range resp.Content {
+		if blockMap, ok := block.(map[string]any); ok && blockMap["type"] == "text" {
+			if text, ok := blockMap["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n")), nil
+}
+
+func doAuxRequest(req *http.Request) ([]byte, error) {
+	resp, err := auxClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		apiErr := translateUpstreamError(resp.StatusCode, body)
+		return nil, fmt.Errorf("upstream %d: %s", resp.StatusCode, apiErr.Message)
+	}
+	return body, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	captionConcurrency     = 4
+	maxCaptionContextChars = 2000
+)
+
+const captionSystemPrompt = "You describe images for a coding agent that cannot see them. " +
+	"Describe the image in detail. Transcribe all visible text, code, error messages and UI labels verbatim, " +
+	"and describe layout, diagrams, charts and anything else the agent may need to act on it. Do not add commentary."
+
+var (
+	multimodalMode = "route"
+	captionModel   *AuxModel
+	captionCache   = newDiskCache("captions")
+)
+
+func captionImages(messages []AnthropicMessage, start, roundStart int, ctx *ConvertContext) []AnthropicMessage {
+	if captionModel == nil {
+		return messages
+	}
+
+	if !ctx.Quiet && !ctx.Aggressive {
+		describeImages(messages, roundStart)
+	}
+
+	var result []AnthropicMessage
+	for i := start; i < len(messages); i++ {
+		content, ok := messages[i].Content.([]any)
+		if !ok || messages[i].Role != "user" {
+			continue
+		}
+		rewritten, changed := replaceCaptionedImages(content)
+		if !changed {
+			continue
+		}
+		if result == nil {
+			result = make([]AnthropicMessage, len(messages))
+			copy(result, messages)
+		}
+		result[i].Content = rewritten
+	}
+	if result == nil {
+		return messages
+	}
+	return result
+}
+
+type pendingCaption struct {
+	key     string
+	block   map[string]any
+	context string
+}
+
+func describeImages(messages []AnthropicMessage, roundStart int) {
+	var pending []pendingCaption
+	seen := make(map[string]bool)
+	collect := func(items []any) {
+		context := captionContext(items)
+		for _, item := range items {
+			itemMap, ok := item.(map[string]any)
+			if !ok || itemMap["type"] != "image" {
+				continue
+			}
+			key := imageKey(itemMap)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, ok := captionCache.Get(key); ok {
+				continue
+			}
+			pending = append(pending, pendingCaption{key: key, block: itemMap, context: context})
+		}
+	}
+
+	for i := roundStart; i < len(messages); i++ {
+		content, ok := messages[i].Content.([]any)
+		if !ok || messages[i].Role != "user" {
+			continue
+		}
+		collect(content)
+		for _, block := range content {
+			if blockMap, ok := block.(map[string]any); ok && blockMap["type"] == "tool_result" {
+				if items, ok := blockMap["content"].([]any); ok {
+					collect(items)
+				}
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	sem := make(chan struct{}, captionConcurrency)
+	for _, p := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p pendingCaption) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := describeImage(p); err != nil {
+				addLog(fmt.Sprintf("[✗] Caption image failed: %v", err))
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	addLog(fmt.Sprintf("[Caption] %d/%d images described", succeeded, len(pending)))
+}
+
+func describeImage(p pendingCaption) error {
+	content, err := captionRequestContent(p.block, p.context)
+	if err != nil {
+		return err
+	}
+	caption, err := callAuxModel(captionModel, captionSystemPrompt, content)
+	if err != nil {
+		return err
+	}
+	captionCache.Put(p.key, caption)
+	return nil
+}
+
+func replaceCaptionedImages(items []any) ([]any, bool) {
+	var rewritten []any
+	changed := false
+	for _, item := range items {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			rewritten = append(rewritten, item)
+			continue
+		}
+		switch itemMap["type"] {
+		case "image":
+			if caption, ok := captionCache.Get(imageKey(itemMap)); ok {
+				block := map[string]any{"type": "text", "text": "[image description]\n" + caption}
+				if marker, ok := itemMap["cache_control"]; ok {
+					block["cache_control"] = marker
+				}
+				rewritten = append(rewritten, block)
+				changed = true
+				continue
+			}
+		case "tool_result":
+			if content, ok := itemMap["content"].([]any); ok {
+				if replaced, ok := replaceCaptionedImages(content); ok {
+					rewritten = append(rewritten, copyBlock(itemMap, "content", replaced))
+					changed = true
+					continue
+				}
+			}
+		}
+		rewritten = append(rewritten, item)
+	}
+	return rewritten, changed
+}
+
+func captionContext(items []any) string {
+	var texts []string
+	for _, item := range items {
+		if itemMap, ok := item.(map[string]any); ok && itemMap["type"] == "text" {
+			if text, ok := itemMap["text"].(string); ok && !strings.Contains(text, "<system-reminder>") {
+				texts = append(texts, text)
+			}
+		}
+	}
+	context := strings.TrimSpace(strings.Join(texts, "\n"))
+	if len(context) > maxCaptionContextChars {
+		context = context[:maxCaptionContextChars] + "..."
+	}
+	return context
+}
+
+func captionRequestContent(block map[string]any, context string) (any, error) {
+	prompt := "Describe this image."
+	if context != "" {
+		prompt += "\n\nText that accompanies the image:\n" + context
+	}
+
+	if captionModel.APIType == "anthropic" {
+		return []any{
+			map[string]any{"type": "image", "source": shrinkImageBlock(block)["source"]},
+			map[string]any{"type": "text", "text": prompt},
+		}, nil
+	}
+	url, err := imageSourceURL(block, multimodalRemoteImages, true)
+	if err != nil {
+		return nil, err
+	}
+	return []OpenAIContentPart{
+		{Type: "image_url", ImageURL: &ImageURL{URL: url}},
+		{Type: "text", Text: prompt},
+	}, nil
+}
+
+func imageKey(block map[string]any) string {
+	source, ok := block["source"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	var identity string
+	switch source["type"] {
+	case "base64":
+		mediaType, _ := source["media_type"].(string)
+		data, _ := source["data"].(string)
+		if data == "" {
+			return ""
+		}
+		identity = mediaType + "\x00" + data
+	case "url":
+		url, _ := source["url"].(string)
+		if url == "" {
+			return ""
+		}
+		identity = "url\x00" + url
+	default:
+		return ""
+	}
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:16]) + ".txt"
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	maxTrackedConversations = 1000
+	defaultTruncateLines    = 20
+)
+
+var (
+	compressStepTokens   int
+	contextBudget        int
+	compressBoundaries   = make(map[string]int)
+	compressBoundariesMu sync.Mutex
+	toolPolicies         = make(map[string]*ToolPolicy)
+	dedupeToolCalls      bool
+)
+
+func loadCompressConfig() {
+	data, err := os.ReadFile("compress.json")
+	if err != nil {
+		return
+	}
+	var config struct {
+		Tools           map[string]json.RawMessage `json:"tools"`
+		Dedupe          bool                       `json:"dedupe"`
+		SystemReminders string                     `json:"system_reminders"`
+		ReminderChars   int                        `json:"reminder_chars"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		fmt.Printf("[✗] Invalid compress.json: %v\n", err)
+		return
+	}
+	for name, raw := range config.Tools {
+		policy := &ToolPolicy{}
+		if err := json.Unmarshal(raw, &policy.Result); err != nil {
+			if err := json.Unmarshal(raw, policy); err != nil {
+				fmt.Printf("[✗] Invalid policy for tool %s: %v\n", name, err)
+				continue
+			}
+		}
+		switch policy.Result {
+		case "", "keep", "drop", "truncate", "summarize":
+		default:
+			fmt.Printf("[✗] Unknown policy %q for tool %s\n", policy.Result, name)
+			continue
+		}
+		if policy.Input == "" {
+			policy.Input = "drop"
+			if policy.Result == "keep" {
+				policy.Input = "keep"
+			}
+		}
+		if policy.Lines <= 0 {
+			policy.Lines = defaultTruncateLines
+		}
+		toolPolicies[name] = policy
+	}
+	dedupeToolCalls = config.Dedupe
+	switch config.SystemReminders {
+	case "":
+	case "keep", "strip", "condense":
+		reminderMode = config.SystemReminders
+	default:
+		fmt.Printf("[✗] Unknown system_reminders mode %q\n", config.SystemReminders)
+	}
+	if config.ReminderChars > 0 {
+		reminderChars = config.ReminderChars
+	}
+	fmt.Println("[✓] Loaded compress.json")
+}
+
+func dedupeToolResults(messages []AnthropicMessage, start, end int, ctx *ConvertContext) []AnthropicMessage {
+	if !dedupeToolCalls {
+		return messages
+	}
+
+	callKeys := make(map[string]string)
+	latest := make(map[string]string)
+	for _, msg := range messages[start:end] {
+		content, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch blockMap["type"] {
+			case "tool_use":
+				id, _ := blockMap["id"].(string)
+				name, _ := blockMap["name"].(string)
+				input, _ := json.Marshal(blockMap["input"])
+				callKeys[id] = name + "\x00" + string(input)
+			case "tool_result":
+				id, _ := blockMap["tool_use_id"].(string)
+				if key, ok := callKeys[id]; ok {
+					latest[key] = id
+				}
+			}
+		}
+	}
+
+	var result []AnthropicMessage
+	for i, msg := range messages {
+		content, ok := msg.Content.([]any)
+		if !ok || i < start || i >= end || msg.Role != "user" {
+			continue
+		}
+		var rewritten []any
+		changed := false
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if ok && blockMap["type"] == "tool_result" {
+				id, _ := blockMap["tool_use_id"].(string)
+				key, known := callKeys[id]
+				if known && latest[key] != id && ctx.resultPolicy(id) != "keep" {
+					name, _, _ := strings.Cut(key, "\x00")
+					ctx.Stats.Deduplicated++
+					changed = true
+					rewritten = append(rewritten, map[string]any{
+						"type":        "tool_result",
+						"tool_use_id": id,
+						"content":     fmt.Sprintf("[superseded by a later %s call with the same input]", name),
+					})
+					continue
+				}
+			}
+			rewritten = append(rewritten, block)
+		}
+		if changed {
+			if result == nil {
+				result = make([]AnthropicMessage, len(messages))
+				copy(result, messages)
+			}
+			result[i].Content = rewritten
+		}
+	}
+	if result == nil {
+		return messages
+	}
+	return result
+}
+
+func toolNamesByID(messages []AnthropicMessage) map[string]string {
+	names := make(map[string]string)
+	if len(toolPolicies) == 0 {
+		return names
+	}
+	for _, msg := range messages {
+		content, ok := msg.Content.([]any)
+		if !ok || msg.Role != "assistant" {
+			continue
+		}
+		for _, block := range content {
+			if blockMap, ok := block.(map[string]any); ok && blockMap["type"] == "tool_use" {
+				id, _ := blockMap["id"].(string)
+				name, _ := blockMap["name"].(string)
+				names[id] = name
+			}
+		}
+	}
+	return names
+}
+
+func (ctx *ConvertContext) resultPolicy(toolUseID string) string {
+	if policy := toolPolicies[ctx.ToolNames[toolUseID]]; policy != nil {
+		return policy.Result
+	}
+	return ""
+}
+
+func keepToolInput(name string) bool {
+	policy := toolPolicies[name]
+	return policy != nil && policy.Input == "keep"
+}
+
+func truncateLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n*2 {
+		return text
+	}
+	omitted := len(lines) - n*2
+	return strings.Join(lines[:n], "\n") +
+		fmt.Sprintf("\n... (%d lines omitted) ...\n", omitted) +
+		strings.Join(lines[len(lines)-n:], "\n")
+}
+
+func prepareHistory(req *AnthropicRequest, ctx *ConvertContext) ([]AnthropicMessage, int, int) {
+	rounds := keepRounds
+	if ctx.UseMultimodal || ctx.Aggressive {
+		rounds = 1
+	}
+
+	start := 0
+	if ctx.UseMultimodal && multimodalMaxRounds > 0 {
+		maxRounds := multimodalMaxRounds
+		if ctx.Aggressive {
+			maxRounds = 1
+		}
+		start = getTrimBoundary(req.Messages, maxRounds)
+	}
+
+	ctx.ToolNames = toolNamesByID(req.Messages)
+
+	history := *req
+	history.Messages = captionImages(req.Messages, start, getLastRoundStart(req), ctx)
+	history.Messages = rewriteReminders(history.Messages, start, getLastRoundStart(req), compressCounter(req, ctx), ctx)
+	if ctx.Aggressive {
+		history.Messages = truncateLongResults(history.Messages, start, ctx)
+	}
+
+	boundary := compressBoundaryFor(&history, rounds, ctx)
+	dedupeEnd := len(history.Messages)
+	if compressStepTokens > 0 {
+		dedupeEnd = boundary
+	}
+	history.Messages = dedupeToolResults(history.Messages, start, dedupeEnd, ctx)
+	plan := planContextBudget(&history, start, boundary, ctx)
+	summarizeCompressedResults(history.Messages, start, boundary, plan, ctx)
+	return plan.apply(history.Messages, ctx), start, boundary
+}
+
+func compressBoundaryFor(req *AnthropicRequest, rounds int, ctx *ConvertContext) int {
+	candidate := getCompressBoundary(req.Messages, rounds)
+	if compressStepTokens <= 0 || ctx.UseMultimodal || ctx.Aggressive || candidate == 0 {
+		return candidate
+	}
+
+	key := conversationKey(req)
+
+	compressBoundariesMu.Lock()
+	defer compressBoundariesMu.Unlock()
+
+	boundary, ok := compressBoundaries[key]
+	if !ok || boundary > candidate || !isRoundStart(req.Messages, boundary) {
+		if ctx.Quiet {
+			return candidate
+		}
+		if len(compressBoundaries) >= maxTrackedConversations {
+			compressBoundaries = make(map[string]int)
+		}
+		compressBoundaries[key] = candidate
+		return candidate
+	}
+	if boundary == candidate {
+		return boundary
+	}
+
+	counter := compressCounter(req, ctx)
+	pending := 0
+	for i := boundary; i < candidate; i++ {
+		pending += estimateAnthropicMessageTokens(counter, req.Messages[i])
+	}
+	if pending < compressStepTokens {
+		return boundary
+	}
+	if ctx.Quiet {
+		return candidate
+	}
+
+	addLog(fmt.Sprintf("[Compress] Cache step: boundary %d -> %d (~%d tokens)", boundary, candidate, pending))
+	compressBoundaries[key] = candidate
+	return candidate
+}
+
+func conversationKey(req *AnthropicRequest) string {
+	if len(req.Messages) == 0 {
+		return ""
+	}
+	return prefixHashes(req.System, req.Messages[:1])[0]
+}
+
+func isRoundStart(messages []AnthropicMessage, idx int) bool {
+	if idx == 0 {
+		return true
+	}
+	if idx < 0 || idx >= len(messages) {
+		return false
+	}
+	return messages[idx].Role == "user" && !hasToolResult(messages[idx])
+}
+
+type budgetPlan struct {
+	toolResults map[string]bool
+	toolInputs  map[string]bool
+	thinking    map[int]bool
+}
+
+type budgetCandidate struct {
+	msg    int
+	id     string
+	tokens int
+}
+
+func planContextBudget(req *AnthropicRequest, start, boundary int, ctx *ConvertContext) *budgetPlan {
+	if contextBudget <= 0 {
+		return nil
+	}
+
+	counter := compressCounter(req, ctx)
+	total := estimateAnthropicContentTokens(counter, req.System)
+	if len(req.Tools) > 0 {
+		data, _ := json.Marshal(req.Tools)
+		total += counter.Count(string(data))
+	}
+
+	roundStart := getLastRoundStart(req)
+	var toolResults, toolInputs, thinking []budgetCandidate
+	for i := start; i < len(req.Messages); i++ {
+		msg := req.Messages[i]
+		total += estimateAnthropicMessageTokens(counter, msg)
+		content, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		thinkingTokens := 0
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if !ok {
+				continue
+			}
+			var candidate *budgetCandidate
+			switch blockMap["type"] {
+			case "tool_result":
+				id, _ := blockMap["tool_use_id"].(string)
+				if ctx.resultPolicy(id) == "keep" {
+					continue
+				}
+				tokens := estimateAnthropicContentTokens(counter, blockMap["content"])
+				toolResults = append(toolResults, budgetCandidate{msg: i, id: id, tokens: tokens})
+				candidate = &toolResults[len(toolResults)-1]
+			case "tool_use":
+				id, _ := blockMap["id"].(string)
+				if name, _ := blockMap["name"].(string); keepToolInput(name) {
+					continue
+				}
+				input, _ := json.Marshal(blockMap["input"])
+				tokens := counter.Count(string(input))
+				toolInputs = append(toolInputs, budgetCandidate{msg: i, id: id, tokens: tokens})
+				candidate = &toolInputs[len(toolInputs)-1]
+			case "thinking":
+				text, _ := blockMap["thinking"].(string)
+				thinkingTokens += counter.Count(text)
+			}
+			if candidate != nil && i < boundary {
+				total -= candidate.tokens
+			}
+		}
+		if thinkingTokens > 0 {
+			thinking = append(thinking, budgetCandidate{msg: i, tokens: thinkingTokens})
+			if i < boundary {
+				total -= thinkingTokens
+			}
+		}
+	}
+
+	plan := &budgetPlan{
+		toolResults: make(map[string]bool),
+		toolInputs:  make(map[string]bool),
+		thinking:    make(map[int]bool),
+	}
+	ctx.Stats.EstimatedTokens = total
+	for _, pass := range []struct {
+		candidates []budgetCandidate
+		mark       func(c budgetCandidate)
+	}{
+		{toolResults, func(c budgetCandidate) { plan.toolResults[c.id] = true }},
+		{toolInputs, func(c budgetCandidate) { plan.toolInputs[c.id] = true }},
+		{thinking, func(c budgetCandidate) { plan.thinking[c.msg] = true }},
+	} {
+		for _, c := range pass.candidates {
+			if total <= contextBudget {
+				break
+			}
+			if c.msg < boundary || c.msg >= roundStart || c.tokens == 0 {
+				continue
+			}
+			pass.mark(c)
+			total -= c.tokens
+		}
+	}
+	ctx.Stats.BudgetTokens = total
+	return plan
+}
+
+func (p *budgetPlan) apply(messages []AnthropicMessage, ctx *ConvertContext) []AnthropicMessage {
+	if p == nil || (len(p.toolResults) == 0 && len(p.toolInputs) == 0 && len(p.thinking) == 0) {
+		return messages
+	}
+
+	result := make([]AnthropicMessage, len(messages))
+	copy(result, messages)
+	for i, msg := range result {
+		content, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		var rewritten []any
+		changed := false
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if !ok {
+				rewritten = append(rewritten, block)
+				continue
+			}
+			switch blockMap["type"] {
+			case "tool_result":
+				id, _ := blockMap["tool_use_id"].(string)
+				if p.toolResults[id] {
+					ctx.Stats.ToolResults++
+					changed = true
+					rewritten = append(rewritten, map[string]any{
+						"type":        "tool_result",
+						"tool_use_id": id,
+						"content":     compressedToolResult(id, blockMap["content"], ctx),
+					})
+					continue
+				}
+			case "tool_use":
+				id, _ := blockMap["id"].(string)
+				if p.toolInputs[id] {
+					ctx.Stats.ToolCalls++
+					changed = true
+					rewritten = append(rewritten, map[string]any{
+						"type":  "tool_use",
+						"id":    id,
+						"name":  blockMap["name"],
+						"input": map[string]any{"compressed": true},
+					})
+					continue
+				}
+			case "thinking":
+				if p.thinking[i] {
+					ctx.Stats.ThinkingBlocks++
+					changed = true
+					continue
+				}
+			}
+			rewritten = append(rewritten, block)
+		}
+		if changed {
+			result[i].Content = rewritten
+		}
+	}
+	return result
+}
+
+func compressCounter(req *AnthropicRequest, ctx *ConvertContext) TokenCounter {
+	return ctx.tokenCounter(req.Model)
+}
+
+func (ctx *ConvertContext) tokenCounter(fallbackModel string) TokenCounter {
+	if ctx.UseMultimodal {
+		return tokenCounterForModel(multimodalModel)
+	}
+	if ctx.Route != nil && ctx.Route.Model != "" {
+		return tokenCounterForModel(ctx.Route.Model)
+	}
+	return tokenCounterForModel(fallbackModel)
+}
+
+func logCompressionStats(ctx *ConvertContext) {
+	stats := ctx.Stats
+	if ctx.Quiet || (stats.ThinkingBlocks == 0 && stats.ToolCalls == 0 && stats.ToolResults == 0 && stats.Deduplicated == 0 && stats.Truncated == 0 && stats.Reminders == 0) {
+		return
+	}
+	msg := fmt.Sprintf("[Compress] %d thinking, %d tool_use, %d tool_result", stats.ThinkingBlocks, stats.ToolCalls, stats.ToolResults)
+	if stats.Deduplicated > 0 {
+		msg += fmt.Sprintf(", %d deduplicated", stats.Deduplicated)
+	}
+	if stats.Truncated > 0 {
+		msg += fmt.Sprintf(", %d truncated", stats.Truncated)
+	}
+	if stats.Reminders > 0 {
+		action := "stripped"
+		if reminderMode == "condense" {
+			action = "condensed"
+		}
+		msg += fmt.Sprintf(", %d reminders %s (~%d tokens saved)", stats.Reminders, action, stats.ReminderTokens)
+	}
+	if contextBudget > 0 && stats.EstimatedTokens > 0 {
+		msg += fmt.Sprintf(" (~%d -> ~%d tokens, budget %d)", stats.EstimatedTokens, stats.BudgetTokens, contextBudget)
+	}
+	addLog(msg)
+}
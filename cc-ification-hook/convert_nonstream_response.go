@@ -9,29 +9,29 @@ import (
 	"time"
 )
 
-func handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, originalModel string) {
+func handleNonStreamingResponse(w http.ResponseWriter, resp *http.Response, originalModel string, interceptor Interceptor) {
 	addLog("[NonStream] Processing non-streaming response")
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		writeNonStreamError(w, err)
+		writeError(w, err)
 		return
 	}
 
 	var openaiResp OpenAINonStreamResponse
 	if err := json.Unmarshal(body, &openaiResp); err != nil {
-		writeNonStreamError(w, err)
+		writeError(w, err)
 		return
 	}
 
-	anthropicResp := convertOpenAIToAnthropicResponse(&openaiResp, originalModel)
+	anthropicResp := convertOpenAIToAnthropicResponse(&openaiResp, originalModel, interceptor)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(anthropicResp)
 }
 
-func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, originalModel string) *AnthropicResponse {
+func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, originalModel string, interceptor Interceptor) *AnthropicResponse {
 	messageID := fmt.Sprintf("msg_%d", time.Now().UnixNano())
 
 	var content []any
@@ -39,6 +39,9 @@ func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, origi
 
 	if len(openaiResp.Choices) > 0 {
 		choice := openaiResp.Choices[0]
+		if interceptor != nil {
+			interceptNonStreamMessage(interceptor, &choice.Message)
+		}
 
 		reasoning := extractNonStreamReasoning(&choice.Message)
 		if reasoning != "" {
@@ -69,7 +72,11 @@ func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, origi
 			})
 		}
 
-		stopReason = convertFinishReason(choice.FinishReason)
+		finishReason := choice.FinishReason
+		if finishReason == "stop" && len(choice.Message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		stopReason = convertFinishReason(finishReason)
 	}
 
 	if len(content) == 0 {
@@ -79,23 +86,27 @@ func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, origi
 		})
 	}
 
+	promptTokens := 0
 	inputTokens := 0
 	outputTokens := 0
 	cachedTokens := 0
+	cacheCreationTokens := 0
 	responseTotalTokens := 0
-	if openaiResp.Usage != nil {
-		inputTokens = int(float64(openaiResp.Usage.PromptTokens) * tokenScaleFactor)
-		outputTokens = int(float64(openaiResp.Usage.CompletionTokens) * tokenScaleFactor)
-		responseTotalTokens = int(float64(openaiResp.Usage.TotalTokens) * tokenScaleFactor)
-		if openaiResp.Usage.PromptTokensDetails != nil {
-			cachedTokens = int(float64(openaiResp.Usage.PromptTokensDetails.CachedTokens) * tokenScaleFactor)
-		}
+	if usage := openaiResp.Usage; usage != nil {
+		cacheRead, cacheCreation := cacheTokenDetails(usage)
+		promptTokens = scaleTokens(usage.PromptTokens)
+		inputTokens = scaleTokens(uncachedInputTokens(usage))
+		outputTokens = scaleTokens(usage.CompletionTokens)
+		responseTotalTokens = scaleTokens(usage.TotalTokens)
+		cachedTokens = scaleTokens(cacheRead)
+		cacheCreationTokens = scaleTokens(cacheCreation)
 	}
 
 	statsMu.Lock()
-	totalPromptTokens += int64(inputTokens)
+	totalPromptTokens += int64(promptTokens)
 	totalCompletionTokens += int64(outputTokens)
 	totalCachedTokens += int64(cachedTokens)
+	totalCacheCreationTokens += int64(cacheCreationTokens)
 	totalTokens += int64(responseTotalTokens)
 	statsMu.Unlock()
 
@@ -108,13 +119,41 @@ func convertOpenAIToAnthropicResponse(openaiResp *OpenAINonStreamResponse, origi
 		StopReason:   stopReason,
 		StopSequence: nil,
 		Usage: &AnthropicUsage{
-			InputTokens:          inputTokens,
-			OutputTokens:         outputTokens,
-			CacheReadInputTokens: cachedTokens,
+			InputTokens:              inputTokens,
+			OutputTokens:             outputTokens,
+			CacheReadInputTokens:     cachedTokens,
+			CacheCreationInputTokens: cacheCreationTokens,
 		},
 	}
 }
 
+func interceptNonStreamMessage(interceptor Interceptor, msg *OpenAINonStreamMessage) {
+	delta := &OpenAIDelta{
+		Content:          msg.Content,
+		Reasoning:        msg.Reasoning,
+		ReasoningContent: msg.ReasoningContent,
+		ReasoningDetails: msg.ReasoningDetails,
+	}
+	interceptor.OnDeltaStart(delta)
+	end := &OpenAIDelta{}
+	interceptor.OnStreamEnd(end)
+
+	msg.Content = delta.Content + end.Content
+	msg.Reasoning = delta.Reasoning + end.Reasoning
+	msg.ReasoningContent = delta.ReasoningContent + end.ReasoningContent
+	delta.ToolCalls = append(delta.ToolCalls, end.ToolCalls...)
+
+	positions := make(map[int]int)
+	for _, tc := range delta.ToolCalls {
+		if pos, ok := positions[tc.Index]; ok {
+			msg.ToolCalls[pos].Function.Arguments += tc.Function.Arguments
+			continue
+		}
+		positions[tc.Index] = len(msg.ToolCalls)
+		msg.ToolCalls = append(msg.ToolCalls, tc)
+	}
+}
+
 func extractNonStreamReasoning(msg *OpenAINonStreamMessage) string {
 	if msg.Reasoning != "" {
 		return msg.Reasoning
@@ -133,14 +172,3 @@ func extractNonStreamReasoning(msg *OpenAINonStreamMessage) string {
 	}
 	return ""
 }
-
-func writeNonStreamError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
-	json.NewEncoder(w).Encode(map[string]any{
-		"error": map[string]any{
-			"type":    "api_error",
-			"message": err.Error(),
-		},
-	})
-}
@@ -6,80 +6,102 @@ import (
 	"strings"
 )
 
-func convertRequest(req *AnthropicRequest) (*ConvertResult, error) {
-	useMultimodal := currentRoundHasImage(req) && multimodalURL != ""
+func convertRequest(req *AnthropicRequest, route *Route, backendURL string, aggressive bool) (*ConvertResult, error) {
+	ctx := &ConvertContext{
+		Route:         route,
+		UseMultimodal: useMultimodalRoute(req),
+		Aggressive:    aggressive,
+	}
+	if backendURL == "" {
+		backendURL = ctx.servingRoute().primaryURL()
+	}
+	ctx.BackendURL = backendURL
 
-	if useMultimodal && multimodalAPIType == "anthropic" {
+	if ctx.UseMultimodal && multimodalAPIType == "anthropic" {
+		preprocessedReq, err := preprocessAnthropicRequest(req, ctx)
+		if err != nil {
+			return nil, err
+		}
 		return &ConvertResult{
-			AnthropicRequest: preprocessAnthropicRequest(req, true),
+			AnthropicRequest: preprocessedReq,
 			UseMultimodal:    true,
 			IsAnthropic:      true,
+			Route:            route,
+			BackendURL:       backendURL,
+			Source:           req,
+			Aggressive:       aggressive,
 		}, nil
 	}
 
-	openaiReq, err := convertAnthropicToOpenAI(req, useMultimodal)
+	ctx.Interceptor = CreateInterceptor(route, backendURL)
+
+	openaiReq, err := convertAnthropicToOpenAI(req, ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ConvertResult{
 		OpenAIRequest: openaiReq,
-		UseMultimodal: useMultimodal,
+		UseMultimodal: ctx.UseMultimodal,
 		IsAnthropic:   false,
+		Route:         route,
+		Interceptor:   ctx.Interceptor,
+		BackendURL:    backendURL,
+		Source:        req,
+		Aggressive:    aggressive,
 	}, nil
 }
 
-func preprocessAnthropicRequest(req *AnthropicRequest, useMultimodal bool) *AnthropicRequest {
+func (ctx *ConvertContext) servingRoute() *Route {
+	if ctx.UseMultimodal {
+		return multimodalRoute
+	}
+	return ctx.Route
+}
+
+func preprocessAnthropicRequest(req *AnthropicRequest, ctx *ConvertContext) (*AnthropicRequest, error) {
 	preprocessedReq := *req
 
 	preprocessedReq.Thinking = nil
 
-	if useMultimodal {
+	if ctx.UseMultimodal {
 		preprocessedReq.Model = multimodalModel
 		if multimodalMaxTokens > 0 && preprocessedReq.MaxTokens > multimodalMaxTokens {
 			preprocessedReq.MaxTokens = multimodalMaxTokens
 		}
-		addLog("[Multimodal] Image in last message, using multimodal API")
-	}
-
-	rounds := keepRounds
-	if useMultimodal {
-		rounds = 1
-	}
-
-	startIdx := 0
-	if useMultimodal && multimodalMaxRounds > 0 {
-		startIdx = getTrimBoundary(req.Messages, multimodalMaxRounds)
+		if !ctx.Quiet {
+			addLog("[Multimodal] Image in last message, using multimodal API")
+		}
 	}
 
-	compressBoundary := getCompressBoundary(req.Messages, rounds)
+	sourceMessages, startIdx, compressBoundary := prepareHistory(req, ctx)
 	lastIdx := len(req.Messages) - 1
 	roundStart := getLastRoundStart(req)
 
-	var stats CompressionStats
 	var preprocessedMessages []AnthropicMessage
 	for i := startIdx; i <= lastIdx; i++ {
-		msg := req.Messages[i]
-		compress := rounds > 0 && i < compressBoundary
+		msg := sourceMessages[i]
+		compress := i < compressBoundary
 		isInLastRound := i >= roundStart
-		preprocessedMsg := preprocessAnthropicMessage(msg, compress, isInLastRound, useMultimodal, &stats)
+		preprocessedMsg, err := preprocessAnthropicMessage(msg, ctx, compress, isInLastRound)
+		if err != nil {
+			return nil, err
+		}
 		if preprocessedMsg != nil {
 			preprocessedMessages = append(preprocessedMessages, *preprocessedMsg)
 		}
 	}
 	preprocessedReq.Messages = preprocessedMessages
 
-	if stats.ThinkingBlocks > 0 || stats.ToolCalls > 0 || stats.ToolResults > 0 {
-		addLog(fmt.Sprintf("[Compress] %d thinking, %d tool_use, %d tool_result", stats.ThinkingBlocks, stats.ToolCalls, stats.ToolResults))
-	}
+	logCompressionStats(ctx)
 
-	return &preprocessedReq
+	return &preprocessedReq, nil
 }
 
-func preprocessAnthropicMessage(msg AnthropicMessage, compress bool, isInLastRound bool, useMultimodal bool, stats *CompressionStats) *AnthropicMessage {
+func preprocessAnthropicMessage(msg AnthropicMessage, ctx *ConvertContext, compress bool, isInLastRound bool) (*AnthropicMessage, error) {
 	content, ok := msg.Content.([]any)
 	if !ok {
-		return &msg
+		return &msg, nil
 	}
 
 	var preprocessedContent []any
@@ -92,10 +114,18 @@ func preprocessAnthropicMessage(msg AnthropicMessage, compress bool, isInLastRou
 		blockType, _ := blockMap["type"].(string)
 		switch blockType {
 		case "thinking":
-			continue
-		case "tool_use":
 			if compress {
-				stats.ToolCalls++
+				ctx.Stats.ThinkingBlocks++
+				continue
+			}
+			// Only count_tokens converts without UseMultimodal; the counter ignores past thinking blocks.
+			if thinking, _ := blockMap["thinking"].(string); thinking != "" && !ctx.UseMultimodal {
+				preprocessedContent = append(preprocessedContent, map[string]any{"type": "text", "text": thinking})
+			}
+		case "tool_use":
+			name, _ := blockMap["name"].(string)
+			if compress && !keepToolInput(name) {
+				ctx.Stats.ToolCalls++
 				preprocessedContent = append(preprocessedContent, map[string]any{
 					"type":  "tool_use",
 					"id":    blockMap["id"],
@@ -106,31 +136,38 @@ func preprocessAnthropicMessage(msg AnthropicMessage, compress bool, isInLastRou
 				preprocessedContent = append(preprocessedContent, block)
 			}
 		case "tool_result":
-			if compress {
-				stats.ToolResults++
+			toolUseID, _ := blockMap["tool_use_id"].(string)
+			if compress && ctx.resultPolicy(toolUseID) != "keep" {
+				ctx.Stats.ToolResults++
 				preprocessedContent = append(preprocessedContent, map[string]any{
 					"type":        "tool_result",
-					"tool_use_id": blockMap["tool_use_id"],
+					"tool_use_id": toolUseID,
 					"content": []any{
-						map[string]any{"type": "text", "text": "[compressed]"},
+						map[string]any{"type": "text", "text": compressedToolResult(toolUseID, blockMap["content"], ctx)},
 					},
 				})
 			} else {
 				preprocessedContent = append(preprocessedContent, map[string]any{
 					"type":        "tool_result",
-					"tool_use_id": blockMap["tool_use_id"],
-					"content":     replaceToolResultImages(blockMap["content"], isInLastRound, useMultimodal),
+					"tool_use_id": toolUseID,
+					"content":     replaceToolResultImages(blockMap["content"], isInLastRound, ctx),
 				})
 			}
 		case "image":
-			if isInLastRound && useMultimodal {
-				preprocessedContent = append(preprocessedContent, block)
+			if isInLastRound && ctx.UseMultimodal {
+				preprocessedContent = append(preprocessedContent, ctx.shrinkImage(blockMap))
 			} else {
 				preprocessedContent = append(preprocessedContent, map[string]any{
 					"type": "text",
 					"text": "[image]",
 				})
 			}
+		case "document":
+			document, err := ctx.documentBlock(blockMap)
+			if err != nil {
+				return nil, err
+			}
+			preprocessedContent = append(preprocessedContent, document)
 		default:
 			preprocessedContent = append(preprocessedContent, block)
 		}
@@ -139,24 +176,38 @@ func preprocessAnthropicMessage(msg AnthropicMessage, compress bool, isInLastRou
 	return &AnthropicMessage{
 		Role:    msg.Role,
 		Content: preprocessedContent,
+	}, nil
+}
+
+func isEmptyContent(content any) bool {
+	switch v := content.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
 	}
+	return false
 }
 
-func convertAnthropicToOpenAI(req *AnthropicRequest, useMultimodal bool) (*OpenAIRequest, error) {
+func convertAnthropicToOpenAI(req *AnthropicRequest, ctx *ConvertContext) (*OpenAIRequest, error) {
 	openaiReq := &OpenAIRequest{
 		Model:     req.Model,
 		MaxTokens: req.MaxTokens,
 		Stream:    req.Stream,
 	}
 
-	if useMultimodal {
+	if ctx.UseMultimodal {
 		openaiReq.Model = multimodalModel
 		if multimodalMaxTokens > 0 && openaiReq.MaxTokens > multimodalMaxTokens {
 			openaiReq.MaxTokens = multimodalMaxTokens
 		}
-		addLog("[Multimodal] Image in last message, using multimodal API")
-	} else if backendModel != "" {
-		openaiReq.Model = backendModel
+		if !ctx.Quiet {
+			addLog("[Multimodal] Image in last message, using multimodal API")
+		}
+	} else if ctx.Route.Model != "" {
+		openaiReq.Model = ctx.Route.Model
 	}
 
 	if req.Temperature != nil {
@@ -177,16 +228,15 @@ func convertAnthropicToOpenAI(req *AnthropicRequest, useMultimodal bool) (*OpenA
 		openaiReq.ReasoningEffort = budgetToEffort(req.Thinking.BudgetTokens)
 	}
 
-	var stats CompressionStats
-	messages, err := convertMessages(req, useMultimodal, &stats)
+	ctx.PromptCache = supportsPromptCache(ctx.servingRoute(), ctx.BackendURL)
+
+	messages, err := convertMessages(req, ctx)
 	if err != nil {
 		return nil, err
 	}
 	openaiReq.Messages = messages
 
-	if stats.ThinkingBlocks > 0 || stats.ToolCalls > 0 || stats.ToolResults > 0 {
-		addLog(fmt.Sprintf("[Compress] %d thinking, %d tool_use, %d tool_result", stats.ThinkingBlocks, stats.ToolCalls, stats.ToolResults))
-	}
+	logCompressionStats(ctx)
 
 	if len(req.Tools) > 0 {
 		openaiReq.Tools = convertTools(req.Tools)
@@ -196,15 +246,19 @@ func convertAnthropicToOpenAI(req *AnthropicRequest, useMultimodal bool) (*OpenA
 		openaiReq.ToolChoice = convertToolChoice(req.ToolChoice)
 	}
 
+	if ctx.Interceptor != nil {
+		ctx.Interceptor.OnRequest(openaiReq)
+	}
+
 	return openaiReq, nil
 }
 
-func convertMessages(req *AnthropicRequest, useMultimodal bool, stats *CompressionStats) ([]OpenAIMessage, error) {
+func convertMessages(req *AnthropicRequest, ctx *ConvertContext) ([]OpenAIMessage, error) {
 	var messages []OpenAIMessage
 
 	if req.System != nil {
-		systemContent := extractSystemContent(req.System)
-		if systemContent != "" {
+		systemContent := convertSystemContent(req.System, ctx)
+		if !isEmptyContent(systemContent) {
 			messages = append(messages, OpenAIMessage{
 				Role:    "system",
 				Content: systemContent,
@@ -213,26 +267,16 @@ func convertMessages(req *AnthropicRequest, useMultimodal bool, stats *Compressi
 	}
 
 	injectUltrathink := shouldInjectUltrathink(req)
-	rounds := keepRounds
-	if useMultimodal {
-		rounds = 1
-	}
-
-	startIdx := 0
-	if useMultimodal && multimodalMaxRounds > 0 {
-		startIdx = getTrimBoundary(req.Messages, multimodalMaxRounds)
-	}
-
-	compressBoundary := getCompressBoundary(req.Messages, rounds)
+	sourceMessages, startIdx, compressBoundary := prepareHistory(req, ctx)
 	lastIdx := len(req.Messages) - 1
 	roundStart := getLastRoundStart(req)
 
 	for i := startIdx; i <= lastIdx; i++ {
-		msg := req.Messages[i]
+		msg := sourceMessages[i]
 		injectPrompt := injectUltrathink && i == lastIdx
-		compress := rounds > 0 && i < compressBoundary
+		compress := i < compressBoundary
 		isInLastRound := i >= roundStart
-		converted, err := convertMessage(msg, injectPrompt, compress, isInLastRound, useMultimodal, stats)
+		converted, err := convertMessage(msg, ctx, injectPrompt, compress, isInLastRound)
 		if err != nil {
 			return nil, err
 		}
@@ -285,6 +329,10 @@ func getLastRoundStart(req *AnthropicRequest) int {
 	return roundStart
 }
 
+func useMultimodalRoute(req *AnthropicRequest) bool {
+	return multimodalURL != "" && multimodalMode != "caption" && currentRoundHasImage(req)
+}
+
 func currentRoundHasImage(req *AnthropicRequest) bool {
 	if len(req.Messages) == 0 {
 		return false
@@ -354,21 +402,21 @@ func hasToolResult(msg AnthropicMessage) bool {
 	return false
 }
 
-func convertMessage(msg AnthropicMessage, injectPrompt bool, compress bool, isInLastRound bool, useMultimodal bool, stats *CompressionStats) ([]OpenAIMessage, error) {
-	if interceptor != nil {
-		interceptor.OnMessage(&msg)
+func convertMessage(msg AnthropicMessage, ctx *ConvertContext, injectPrompt bool, compress bool, isInLastRound bool) ([]OpenAIMessage, error) {
+	if ctx.Interceptor != nil {
+		ctx.Interceptor.OnMessage(&msg)
 	}
 
 	switch msg.Role {
 	case "user":
-		return convertUserMessage(msg, injectPrompt, compress, isInLastRound, useMultimodal, stats)
+		return convertUserMessage(msg, ctx, injectPrompt, compress, isInLastRound)
 	case "assistant":
-		return convertAssistantMessage(msg, compress, stats)
+		return convertAssistantMessage(msg, ctx, compress)
 	}
 	return nil, nil
 }
 
-func convertUserMessage(msg AnthropicMessage, injectPrompt bool, compress bool, isInLastRound bool, useMultimodal bool, stats *CompressionStats) ([]OpenAIMessage, error) {
+func convertUserMessage(msg AnthropicMessage, ctx *ConvertContext, injectPrompt bool, compress bool, isInLastRound bool) ([]OpenAIMessage, error) {
 	var messages []OpenAIMessage
 
 	content, ok := msg.Content.([]any)
@@ -377,7 +425,9 @@ func convertUserMessage(msg AnthropicMessage, injectPrompt bool, compress bool,
 			finalContent := str
 			if injectPrompt {
 				finalContent = str + "\n\n" + ultrathinkPrompt
-				printInjectionLog(str)
+				if !ctx.Quiet {
+					printInjectionLog(str)
+				}
 			}
 			messages = append(messages, OpenAIMessage{
 				Role:    "user",
@@ -403,45 +453,61 @@ func convertUserMessage(msg AnthropicMessage, injectPrompt bool, compress bool,
 		case "text":
 			text, _ := blockMap["text"].(string)
 			contentParts = append(contentParts, OpenAIContentPart{
-				Type: "text",
-				Text: text,
+				Type:         "text",
+				Text:         text,
+				CacheControl: ctx.cacheControl(blockMap),
 			})
 		case "image":
-			if isInLastRound && useMultimodal {
-				source, ok := blockMap["source"].(map[string]any)
-				if ok {
-					mediaType, _ := source["media_type"].(string)
-					data, _ := source["data"].(string)
-					contentParts = append(contentParts, OpenAIContentPart{
-						Type: "image_url",
-						ImageURL: &ImageURL{
-							URL: fmt.Sprintf("data:%s;base64,%s", mediaType, data),
-						},
-					})
+			if isInLastRound && ctx.UseMultimodal {
+				url, err := ctx.imageURL(blockMap)
+				if err != nil {
+					return nil, err
 				}
+				contentParts = append(contentParts, OpenAIContentPart{
+					Type: "image_url",
+					ImageURL: &ImageURL{
+						URL: url,
+					},
+					CacheControl: ctx.cacheControl(blockMap),
+				})
 			} else {
+				if isInLastRound && captionModel != nil {
+					if err := validateImageSource(blockMap); err != nil {
+						return nil, err
+					}
+				}
 				contentParts = append(contentParts, OpenAIContentPart{
 					Type: "text",
 					Text: "[image]",
 				})
 			}
+		case "document":
+			part, err := ctx.documentPart(blockMap)
+			if err != nil {
+				return nil, err
+			}
+			contentParts = append(contentParts, part)
 		case "tool_result":
 			toolUseID, _ := blockMap["tool_use_id"].(string)
 			if seenToolResults[toolUseID] {
 				continue
 			}
 			seenToolResults[toolUseID] = true
-			if compress {
-				stats.ToolResults++
+			if compress && ctx.resultPolicy(toolUseID) != "keep" {
+				ctx.Stats.ToolResults++
 				toolResults = append(toolResults, OpenAIMessage{
 					Role:       "tool",
-					Content:    "[compressed]",
+					Content:    compressedToolResult(toolUseID, blockMap["content"], ctx),
 					ToolCallID: toolUseID,
 				})
 			} else {
+				content, err := extractToolResultContent(blockMap["content"], isInLastRound, ctx)
+				if err != nil {
+					return nil, err
+				}
 				toolResults = append(toolResults, OpenAIMessage{
 					Role:       "tool",
-					Content:    extractToolResultContent(blockMap["content"], isInLastRound, useMultimodal),
+					Content:    withCacheControl(content, ctx.toolResultCacheControl(blockMap)),
 					ToolCallID: toolUseID,
 				})
 			}
@@ -465,7 +531,9 @@ func convertUserMessage(msg AnthropicMessage, injectPrompt bool, compress bool,
 				Type: "text",
 				Text: ultrathinkPrompt,
 			})
-			printInjectionLog(userText)
+			if !ctx.Quiet {
+				printInjectionLog(userText)
+			}
 		}
 		messages = append(messages, OpenAIMessage{
 			Role:    "user",
@@ -476,7 +544,7 @@ func convertUserMessage(msg AnthropicMessage, injectPrompt bool, compress bool,
 	return messages, nil
 }
 
-func convertAssistantMessage(msg AnthropicMessage, compress bool, stats *CompressionStats) ([]OpenAIMessage, error) {
+func convertAssistantMessage(msg AnthropicMessage, ctx *ConvertContext, compress bool) ([]OpenAIMessage, error) {
 	var messages []OpenAIMessage
 
 	content, ok := msg.Content.([]any)
@@ -506,7 +574,7 @@ func convertAssistantMessage(msg AnthropicMessage, compress bool, stats *Compres
 		switch blockType {
 		case "thinking":
 			if compress {
-				stats.ThinkingBlocks++
+				ctx.Stats.ThinkingBlocks++
 			} else {
 				thinking, _ := blockMap["thinking"].(string)
 				thinkingParts = append(thinkingParts, thinking)
@@ -522,8 +590,8 @@ func convertAssistantMessage(msg AnthropicMessage, compress bool, stats *Compres
 			seenToolUse[id] = true
 			name, _ := blockMap["name"].(string)
 			args := `{"compressed":true}`
-			if compress {
-				stats.ToolCalls++
+			if compress && !keepToolInput(name) {
+				ctx.Stats.ToolCalls++
 			} else {
 				input := blockMap["input"]
 				inputJSON, _ := json.Marshal(input)
@@ -646,17 +714,17 @@ func extractSystemContent(system any) string {
 	return ""
 }
 
-func replaceToolResultImages(content any, isInLastRound bool, useMultimodal bool) any {
-	if isInLastRound && useMultimodal {
-		return content
-	}
-
+func replaceToolResultImages(content any, isInLastRound bool, ctx *ConvertContext) any {
 	switch v := content.(type) {
 	case []any:
 		var newContent []any
 		for _, item := range v {
 			if itemMap, ok := item.(map[string]any); ok {
 				if itemType, _ := itemMap["type"].(string); itemType == "image" {
+					if isInLastRound && ctx.UseMultimodal {
+						newContent = append(newContent, ctx.shrinkImage(itemMap))
+						continue
+					}
 					newContent = append(newContent, map[string]any{
 						"type": "text",
 						"text": "[image]",
@@ -674,10 +742,10 @@ func replaceToolResultImages(content any, isInLastRound bool, useMultimodal bool
 	}
 }
 
-func extractToolResultContent(content any, isInLastRound bool, useMultimodal bool) any {
+func extractToolResultContent(content any, isInLastRound bool, ctx *ConvertContext) (any, error) {
 	switch v := content.(type) {
 	case string:
-		return v
+		return v, nil
 	case []any:
 		var contentParts []OpenAIContentPart
 		for _, item := range v {
@@ -698,35 +766,45 @@ func extractToolResultContent(content any, isInLastRound bool, useMultimodal boo
 					})
 				}
 			case "image":
-				if isInLastRound && useMultimodal {
-					source, sourceOk := itemMap["source"].(map[string]any)
-					mediaType, mediaTypeOk := source["media_type"].(string)
-					data, dataOk := source["data"].(string)
-					if sourceOk && mediaTypeOk && dataOk {
-						contentParts = append(contentParts, OpenAIContentPart{
-							Type: "image_url",
-							ImageURL: &ImageURL{
-								URL: fmt.Sprintf("data:%s;base64,%s", mediaType, data),
-							},
-						})
+				if isInLastRound && ctx.UseMultimodal {
+					url, err := ctx.imageURL(itemMap)
+					if err != nil {
+						return nil, err
 					}
+					contentParts = append(contentParts, OpenAIContentPart{
+						Type: "image_url",
+						ImageURL: &ImageURL{
+							URL: url,
+						},
+					})
 				} else {
+					if isInLastRound && captionModel != nil {
+						if err := validateImageSource(itemMap); err != nil {
+							return nil, err
+						}
+					}
 					contentParts = append(contentParts, OpenAIContentPart{
 						Type: "text",
 						Text: "[image]",
 					})
 				}
+			case "document":
+				part, err := ctx.documentPart(itemMap)
+				if err != nil {
+					return nil, err
+				}
+				contentParts = append(contentParts, part)
 			}
 		}
-		return contentParts
+		return contentParts, nil
 	default:
 		data, _ := json.Marshal(v)
-		return string(data)
+		return string(data), nil
 	}
 }
 
 func contentPartsToAny(parts []OpenAIContentPart) any {
-	if len(parts) == 1 && parts[0].Type == "text" {
+	if len(parts) == 1 && parts[0].Type == "text" && parts[0].CacheControl == nil {
 		return parts[0].Text
 	}
 	result := make([]any, len(parts))
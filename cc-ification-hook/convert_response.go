@@ -10,7 +10,7 @@ import (
 	"time"
 )
 
-func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, originalModel string, requestStartTime time.Time) {
+func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, originalModel string, requestStartTime time.Time, interceptor Interceptor, estimatedInputTokens int) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
@@ -30,8 +30,9 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 		ThinkingStarted: false,
 		ThinkingIndex:   -1,
 		ToolCalls:       make(map[int]*ToolCallState),
-		Interceptor:     CreateStreamInterceptor(),
+		Interceptor:     interceptor,
 		StartTime:       requestStartTime,
+		InputTokens:     scaleTokens(estimatedInputTokens),
 	}
 
 	recorder := newStreamRecorder()
@@ -52,7 +53,7 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 			"stop_reason":   nil,
 			"stop_sequence": nil,
 			"usage": map[string]any{
-				"input_tokens":  100,
+				"input_tokens":  state.InputTokens,
 				"output_tokens": 1,
 			},
 		},
@@ -60,12 +61,21 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 	flusher.Flush()
 
 	reader := bufio.NewReader(resp.Body)
+	sawDone := false
+	finishReason := ""
 
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
+			if finishReason != "" {
+				break
+			}
 			if err != io.EOF {
 				addLog(fmt.Sprintf("[✗] Stream read error: %v", err))
+				sendStreamError(w, flusher, state, "overloaded_error", fmt.Sprintf("upstream stream interrupted: %v", err))
+			} else if !sawDone {
+				addLog("[✗] Stream ended without finish_reason or [DONE]")
+				sendStreamError(w, flusher, state, "overloaded_error", "upstream stream ended unexpectedly")
 			}
 			break
 		}
@@ -80,6 +90,7 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 		data := strings.TrimPrefix(line, "data: ")
 		if data == "[DONE]" {
 			recorder.RecordChunk("[DONE]")
+			sawDone = true
 			break
 		}
 
@@ -88,11 +99,22 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 			continue
 		}
 
+		if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+			apiErr := translateUpstreamError(http.StatusInternalServerError, []byte(data))
+			errType := "api_error"
+			if apiErr.Type == "rate_limit_error" || apiErr.Type == "overloaded_error" {
+				errType = "overloaded_error"
+			}
+			addLog(fmt.Sprintf("[✗] Upstream stream error: %s", apiErr.Message))
+			sendStreamError(w, flusher, state, errType, apiErr.Message)
+			break
+		}
+
 		if chunk.Usage != nil {
 			state.AccumulatedUsage = chunk.Usage
 		}
 
-		if len(chunk.Choices) == 0 {
+		if len(chunk.Choices) == 0 || finishReason != "" {
 			continue
 		}
 
@@ -116,14 +138,24 @@ func handleStreamingResponse(w http.ResponseWriter, resp *http.Response, origina
 		}
 
 		if choice.FinishReason != "" {
-			finalizeStream(w, flusher, state, choice.FinishReason)
-			state.Finalized = true
-			break
+			finishReason = choice.FinishReason
 		}
 	}
 
 	if !state.Finalized {
-		finalizeStream(w, flusher, state, "end_turn")
+		if state.Interceptor != nil {
+			delta := &OpenAIDelta{}
+			state.Interceptor.OnStreamEnd(delta)
+			emitStreamDelta(w, flusher, state, delta)
+		}
+		if finishReason == "" {
+			finishReason = "end_turn"
+		}
+		if finishReason == "stop" && len(state.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+		finalizeStream(w, flusher, state, finishReason)
+		state.Finalized = true
 	}
 }
 
@@ -131,7 +163,10 @@ func processStreamDelta(w http.ResponseWriter, flusher http.Flusher, state *Stre
 	if state.Interceptor != nil {
 		state.Interceptor.OnDeltaStart(delta)
 	}
+	emitStreamDelta(w, flusher, state, delta)
+}
 
+func emitStreamDelta(w http.ResponseWriter, flusher http.Flusher, state *StreamState, delta *OpenAIDelta) {
 	reasoning := extractStreamReasoning(delta)
 	if reasoning != "" {
 		handleThinkingDelta(w, flusher, state, reasoning)
@@ -299,26 +334,30 @@ func finalizeStream(w http.ResponseWriter, flusher http.Flusher, state *StreamSt
 
 	outputTokens := 0
 	promptTokens := 0
+	inputTokens := state.InputTokens
 	cachedTokens := 0
+	cacheCreationTokens := 0
 	responseTotalTokens := 0
-	if state.AccumulatedUsage != nil {
-		promptTokens = int(float64(state.AccumulatedUsage.PromptTokens) * tokenScaleFactor)
-		outputTokens = int(float64(state.AccumulatedUsage.CompletionTokens) * tokenScaleFactor)
-		responseTotalTokens = int(float64(state.AccumulatedUsage.TotalTokens) * tokenScaleFactor)
-		if state.AccumulatedUsage.PromptTokensDetails != nil {
-			cachedTokens = int(float64(state.AccumulatedUsage.PromptTokensDetails.CachedTokens) * tokenScaleFactor)
-		}
+	if usage := state.AccumulatedUsage; usage != nil {
+		cacheRead, cacheCreation := cacheTokenDetails(usage)
+		promptTokens = scaleTokens(usage.PromptTokens)
+		inputTokens = scaleTokens(uncachedInputTokens(usage))
+		outputTokens = scaleTokens(usage.CompletionTokens)
+		responseTotalTokens = scaleTokens(usage.TotalTokens)
+		cachedTokens = scaleTokens(cacheRead)
+		cacheCreationTokens = scaleTokens(cacheCreation)
 	}
 
 	statsMu.Lock()
 	totalPromptTokens += int64(promptTokens)
 	totalCompletionTokens += int64(outputTokens)
 	totalCachedTokens += int64(cachedTokens)
+	totalCacheCreationTokens += int64(cacheCreationTokens)
 	totalTokens += int64(responseTotalTokens)
 	statsMu.Unlock()
 
 	if diagnosticMode {
-		addLog(fmt.Sprintf("[✓] Output tokens: %d (scale: %.2f)", outputTokens, tokenScaleFactor))
+		addLog(fmt.Sprintf("[✓] Input tokens: %d (estimated %d), output tokens: %d (scale: %.2f)", promptTokens, state.InputTokens, outputTokens, tokenScaleFactor))
 	}
 
 	sendEvent(w, "message_delta", map[string]any{
@@ -328,8 +367,10 @@ func finalizeStream(w http.ResponseWriter, flusher http.Flusher, state *StreamSt
 			"stop_sequence": nil,
 		},
 		"usage": map[string]any{
-			"output_tokens":           outputTokens,
-			"cache_read_input_tokens": cachedTokens,
+			"input_tokens":                inputTokens,
+			"output_tokens":               outputTokens,
+			"cache_read_input_tokens":     cachedTokens,
+			"cache_creation_input_tokens": cacheCreationTokens,
 		},
 	})
 
@@ -342,6 +383,18 @@ func finalizeStream(w http.ResponseWriter, flusher http.Flusher, state *StreamSt
 	recordRequestMetrics(state, outputTokens)
 }
 
+func sendStreamError(w http.ResponseWriter, flusher http.Flusher, state *StreamState, errType string, message string) {
+	sendEvent(w, "error", map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    errType,
+			"message": message,
+		},
+	})
+	flusher.Flush()
+	state.Finalized = true
+}
+
 func extractStreamReasoning(delta *OpenAIDelta) string {
 	var result string
 	if delta.Reasoning != "" {
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type DiskCache struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+func newDiskCache(dir string) *DiskCache {
+	return &DiskCache{dir: dir, entries: make(map[string]string)}
+}
+
+func (c *DiskCache) Get(name string) (string, bool) {
+	c.mu.Lock()
+	value, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok {
+		return value, true
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return "", false
+	}
+	value = string(data)
+
+	c.mu.Lock()
+	c.entries[name] = value
+	c.mu.Unlock()
+	return value, true
+}
+
+func (c *DiskCache) Put(name, value string) {
+	c.mu.Lock()
+	c.entries[name] = value
+	c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		addLog(fmt.Sprintf("[✗] Failed to create %s directory: %v", c.dir, err))
+		return
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, name), []byte(value), 0644); err != nil {
+		addLog(fmt.Sprintf("[✗] Failed to save %s: %v", filepath.Join(c.dir, name), err))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const maxExtractedDocuments = 32
+
+var (
+	extractedDocuments   = make(map[string]string)
+	extractedDocumentsMu sync.Mutex
+)
+
+func (ctx *ConvertContext) documentPart(block map[string]any) (OpenAIContentPart, error) {
+	return ctx.convertDocument(block, ctx.pdfAsFile())
+}
+
+func (ctx *ConvertContext) documentBlock(block map[string]any) (map[string]any, error) {
+	part, err := ctx.convertDocument(block, false)
+	if err != nil {
+		return nil, err
+	}
+	text := map[string]any{"type": "text", "text": part.Text}
+	if marker, ok := block["cache_control"]; ok {
+		text["cache_control"] = marker
+	}
+	return text, nil
+}
+
+func (ctx *ConvertContext) convertDocument(block map[string]any, asFile bool) (OpenAIContentPart, error) {
+	title, _ := block["title"].(string)
+	source, ok := block["source"].(map[string]any)
+	if !ok {
+		return OpenAIContentPart{}, invalidRequestError(fmt.Errorf("document block has no source"))
+	}
+
+	sourceType, _ := source["type"].(string)
+	switch sourceType {
+	case "text":
+		data, _ := source["data"].(string)
+		return OpenAIContentPart{Type: "text", Text: documentText(title, data), CacheControl: ctx.cacheControl(block)}, nil
+	case "content":
+		return OpenAIContentPart{Type: "text", Text: documentText(title, toolResultText(source["content"])), CacheControl: ctx.cacheControl(block)}, nil
+	case "base64", "url":
+	case "file":
+		return OpenAIContentPart{}, invalidRequestError(fmt.Errorf("document source type \"file\" is not supported by this proxy, send the document as base64, url or text"))
+	default:
+		return OpenAIContentPart{}, invalidRequestError(fmt.Errorf("unsupported document source type %q", sourceType))
+	}
+
+	if sourceType == "url" && ctx.Quiet {
+		url, _ := source["url"].(string)
+		return OpenAIContentPart{Type: "text", Text: documentText(title, "[document: "+url+"]")}, nil
+	}
+	data, err := documentPDFData(source)
+	if err != nil {
+		return OpenAIContentPart{}, err
+	}
+
+	if asFile {
+		filename := title
+		if filename == "" {
+			filename = "document"
+		}
+		if !strings.HasSuffix(strings.ToLower(filename), ".pdf") {
+			filename += ".pdf"
+		}
+		return OpenAIContentPart{
+			Type: "file",
+			File: &FilePart{
+				Filename: filename,
+				FileData: "data:application/pdf;base64," + data,
+			},
+			CacheControl: ctx.cacheControl(block),
+		}, nil
+	}
+	return OpenAIContentPart{Type: "text", Text: documentText(title, pdfText(data, ctx.Quiet)), CacheControl: ctx.cacheControl(block)}, nil
+}
+
+func (ctx *ConvertContext) pdfAsFile() bool {
+	route := ctx.Route
+	if ctx.UseMultimodal {
+		route = multimodalRoute
+	}
+	return route != nil && route.PDF == "file"
+}
+
+func documentPDFData(source map[string]any) (string, error) {
+	if source["type"] == "url" {
+		url, _ := source["url"].(string)
+		if url == "" {
+			return "", invalidRequestError(fmt.Errorf("url document source requires url"))
+		}
+		data, mediaType, err := fetchRemote(url, "document")
+		if err != nil {
+			return "", err
+		}
+		if mediaType != "application/pdf" && !strings.HasPrefix(string(data), "%PDF") {
+			return "", invalidRequestError(fmt.Errorf("url %s is not a PDF (%s)", url, mediaType))
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	mediaType, _ := source["media_type"].(string)
+	data, _ := source["data"].(string)
+	if mediaType != "application/pdf" {
+		return "", invalidRequestError(fmt.Errorf("unsupported base64 document media_type %q, only application/pdf is supported", mediaType))
+	}
+	if data == "" {
+		return "", invalidRequestError(fmt.Errorf("base64 document source requires data"))
+	}
+	return data, nil
+}
+
+func pdfText(data string, quiet bool) string {
+	sum := sha256.Sum256([]byte(data))
+	key := hex.EncodeToString(sum[:])
+
+	extractedDocumentsMu.Lock()
+	text, ok := extractedDocuments[key]
+	extractedDocumentsMu.Unlock()
+	if ok {
+		return text
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err == nil {
+		text, err = extractPDFText(raw)
+	}
+	if err != nil {
+		text = fmt.Sprintf("[PDF document: text could not be extracted: %v]", err)
+	} else if text == "" {
+		text = "[PDF document: no extractable text]"
+	}
+	if !quiet {
+		addLog(fmt.Sprintf("[Document] Extracted %d characters from %d KB PDF", len(text), len(raw)>>10))
+	}
+
+	extractedDocumentsMu.Lock()
+	if len(extractedDocuments) >= maxExtractedDocuments {
+		extractedDocuments = make(map[string]string)
+	}
+	extractedDocuments[key] = text
+	extractedDocumentsMu.Unlock()
+	return text
+}
+
+func documentText(title, text string) string {
+	if title == "" {
+		return "<document>\n" + text + "\n</document>"
+	}
+	return fmt.Sprintf("<document title=%q>\n%s\n</document>", title, text)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type APIError struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func invalidRequestError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &APIError{Status: http.StatusBadRequest, Type: "invalid_request_error", Message: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := &APIError{Status: http.StatusInternalServerError, Type: "api_error", Message: err.Error()}
+	errors.As(err, &apiErr)
+	writeAPIError(w, apiErr)
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    apiErr.Type,
+			"message": apiErr.Message,
+		},
+	})
+}
+
+func translateUpstreamError(status int, body []byte) *APIError {
+	code, errType, message := parseUpstreamError(body)
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	anthropicType, anthropicStatus := classifyUpstreamError(status, code, errType, message)
+	return &APIError{
+		Status:  anthropicStatus,
+		Type:    anthropicType,
+		Message: message,
+	}
+}
+
+func isAnthropicErrorBody(body []byte) bool {
+	var parsed struct {
+		Type  string `json:"type"`
+		Error *struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return false
+	}
+	return parsed.Type == "error" && parsed.Error != nil && parsed.Error.Type != ""
+}
+
+func parseUpstreamError(body []byte) (code string, errType string, message string) {
+	var parsed map[string]any
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", "", strings.TrimSpace(string(body))
+	}
+
+	switch e := parsed["error"].(type) {
+	case map[string]any:
+		code = stringifyErrorField(e["code"])
+		errType = stringifyErrorField(e["type"])
+		message = stringifyErrorField(e["message"])
+	case string:
+		message = e
+	}
+
+	if code == "" {
+		code = stringifyErrorField(parsed["code"])
+	}
+	if errType == "" {
+		errType = stringifyErrorField(parsed["type"])
+	}
+	if message == "" {
+		message = stringifyErrorField(parsed["message"])
+	}
+	if message == "" {
+		message = stringifyErrorField(parsed["msg"])
+	}
+	if message == "" {
+		message = stringifyErrorField(parsed["detail"])
+	}
+	return code, errType, message
+}
+
+func stringifyErrorField(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func classifyUpstreamError(status int, code string, errType string, message string) (string, int) {
+	switch code {
+	case "1000", "1001", "1002", "1003", "1004", "invalid_api_key":
+		return "authentication_error", http.StatusUnauthorized
+	case "1110", "1111", "1112", "1113", "1308", "1310", "insufficient_quota":
+		return "permission_error", http.StatusForbidden
+	case "1210", "1211", "1213", "1214", "1261", "1301", "context_length_exceeded", "string_above_max_length":
+		return "invalid_request_error", http.StatusBadRequest
+	case "1302", "1303", "1304", "rate_limit_exceeded":
+		return "rate_limit_error", http.StatusTooManyRequests
+	case "1305", "1312":
+		return "overloaded_error", 529
+	}
+
+	switch errType {
+	case "invalid_request_error", "authentication_error", "permission_error", "not_found_error",
+		"request_too_large", "rate_limit_error", "api_error", "overloaded_error":
+		if status >= 400 {
+			return errType, anthropicStatusForType(errType, status)
+		}
+	case "insufficient_quota":
+		return "permission_error", http.StatusForbidden
+	}
+
+	lower := strings.ToLower(message)
+	if status == http.StatusTooManyRequests && (strings.Contains(lower, "quota") || strings.Contains(lower, "balance")) {
+		return "permission_error", http.StatusForbidden
+	}
+
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error", http.StatusUnauthorized
+	case status == http.StatusPaymentRequired || status == http.StatusForbidden:
+		return "permission_error", http.StatusForbidden
+	case status == http.StatusNotFound:
+		return "not_found_error", http.StatusNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		return "request_too_large", http.StatusRequestEntityTooLarge
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error", http.StatusTooManyRequests
+	case status == http.StatusServiceUnavailable || status == 529:
+		return "overloaded_error", 529
+	case status >= 500:
+		return "api_error", http.StatusInternalServerError
+	case status >= 400:
+		return "invalid_request_error", http.StatusBadRequest
+	}
+	return "api_error", http.StatusInternalServerError
+}
+
+func anthropicStatusForType(errType string, fallback int) int {
+	switch errType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	}
+	if fallback >= 500 {
+		return http.StatusInternalServerError
+	}
+	return fallback
+}
+
+func upstreamRequestError(err error) *APIError {
+	return &APIError{
+		Status:  http.StatusInternalServerError,
+		Type:    "api_error",
+		Message: fmt.Sprintf("upstream request failed: %v", err),
+	}
+}
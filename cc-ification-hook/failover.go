@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+var backendClient = &http.Client{}
+
+func initBackendClient() {
+	backendClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: backendTimeout,
+			MaxIdleConnsPerHost:   8,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
+
+func sendToRoute(r *http.Request, route *Route, result *ConvertResult) (*http.Response, *Backend, *ConvertResult, error) {
+	candidates := route.candidates()
+	if len(candidates) == 0 {
+		return nil, nil, result, fmt.Errorf("route %s has no backends", route.Name)
+	}
+
+	var lastErr error
+	for i, backend := range candidates {
+		backendResult := result.forBackend(backend)
+		resp, err := sendToBackend(r, backend, backendResult.OpenAIRequest)
+		if err != nil {
+			if r.Context().Err() != nil {
+				return nil, backend, backendResult, err
+			}
+			backend.markFailure(err.Error())
+			addLog(fmt.Sprintf("[Failover] %s: %s failed (%v)", route.Name, backend.URL, err))
+			lastErr = err
+			continue
+		}
+
+		if isRetryableStatus(resp.StatusCode) {
+			backend.markFailure(fmt.Sprintf("HTTP %d", resp.StatusCode))
+			if i < len(candidates)-1 {
+				addLog(fmt.Sprintf("[Failover] %s: %s failed (HTTP %d)", route.Name, backend.URL, resp.StatusCode))
+				resp.Body.Close()
+				continue
+			}
+		} else {
+			backend.markSuccess()
+		}
+
+		if i > 0 {
+			addLog(fmt.Sprintf("[Failover] %s: served by %s", route.Name, backend.URL))
+		}
+		recordActiveBackend(route, backend)
+		return resp, backend, backendResult, nil
+	}
+	return nil, candidates[len(candidates)-1], result, lastErr
+}
+
+func (result *ConvertResult) forBackend(backend *Backend) *ConvertResult {
+	if result.Source == nil || backend.URL == result.BackendURL {
+		return result
+	}
+	serving := result.Route
+	if result.UseMultimodal {
+		serving = multimodalRoute
+	}
+	if interceptorFactoryFor(result.Route, backend.URL) == interceptorFactoryFor(result.Route, result.BackendURL) &&
+		supportsPromptCache(serving, backend.URL) == supportsPromptCache(serving, result.BackendURL) {
+		return result
+	}
+	converted, err := convertRequest(result.Source, result.Route, backend.URL, result.Aggressive)
+	if err != nil || converted.IsAnthropic {
+		return result
+	}
+	return converted
+}
+
+func sendToBackend(r *http.Request, backend *Backend, openaiReq *OpenAIRequest) (*http.Response, error) {
+	backendReq := *openaiReq
+	if backend.Model != "" {
+		backendReq.Model = backend.Model
+	}
+
+	body, err := json.Marshal(&backendReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, backend.URL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	apiKey := resolveAPIKey(r, backend)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	return backendClient.Do(req)
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+func (route *Route) primaryURL() string {
+	if candidates := route.candidates(); len(candidates) > 0 {
+		return candidates[0].URL
+	}
+	return route.URL
+}
+
+func (route *Route) candidates() []*Backend {
+	var healthy, unhealthy []*Backend
+	for _, backend := range route.Backends {
+		if backend.isHealthy() {
+			healthy = append(healthy, backend)
+		} else {
+			unhealthy = append(unhealthy, backend)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (b *Backend) isHealthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.unhealthyUntil)
+}
+
+func (b *Backend) markFailure(reason string) {
+	b.mu.Lock()
+	b.failures++
+	b.lastError = reason
+	failures := b.failures
+	if failures >= failureThreshold {
+		b.unhealthyUntil = time.Now().Add(backendCooldown)
+	}
+	b.mu.Unlock()
+
+	if failures == failureThreshold {
+		addLog(fmt.Sprintf("[Health] %s marked unhealthy for %s (%s)", b.URL, backendCooldown, reason))
+	}
+}
+
+func (b *Backend) markSuccess() {
+	b.mu.Lock()
+	recovered := b.failures >= failureThreshold
+	b.failures = 0
+	b.unhealthyUntil = time.Time{}
+	b.lastError = ""
+	b.mu.Unlock()
+
+	if recovered {
+		addLog(fmt.Sprintf("[Health] %s recovered", b.URL))
+	}
+}
+
+func (b *Backend) needsProbe() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= failureThreshold
+}
+
+func (b *Backend) status() map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return map[string]any{
+		"url":       b.URL,
+		"model":     b.Model,
+		"healthy":   !time.Now().Before(b.unhealthyUntil),
+		"failures":  b.failures,
+		"lastError": b.lastError,
+	}
+}
+
+func startHealthProbes() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, route := range allRoutes() {
+				if route == nil {
+					continue
+				}
+				for _, backend := range route.Backends {
+					if backend.needsProbe() {
+						probeBackend(backend)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func probeBackend(backend *Backend) {
+	req, err := http.NewRequest(http.MethodGet, backend.URL+"/models", nil)
+	if err != nil {
+		return
+	}
+	if backend.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+backend.APIKey)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		backend.markProbeFailure(err.Error())
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusTooManyRequests {
+		backend.markProbeFailure(fmt.Sprintf("probe HTTP %d", resp.StatusCode))
+		return
+	}
+	backend.markSuccess()
+}
+
+func (b *Backend) markProbeFailure(reason string) {
+	b.mu.Lock()
+	b.lastError = reason
+	b.unhealthyUntil = time.Now().Add(backendCooldown)
+	b.mu.Unlock()
+}
@@ -34,84 +34,95 @@ func proxyHandler(w http.ResponseWriter, r *http.Request) {
 
 	var anthropicReq AnthropicRequest
 	if err := json.Unmarshal(body, &anthropicReq); err != nil {
-		writeError(w, err)
+		writeError(w, invalidRequestError(err))
 		return
 	}
 
 	originalModel := anthropicReq.Model
+	route := resolveRoute(originalModel)
 
-	result, err := convertRequest(&anthropicReq)
+	result, err := convertRequest(&anthropicReq, route, "", false)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, invalidRequestError(err))
 		return
 	}
 
 	saveDiagnosticRequest(body, result)
 
+	servingRoute := route
+	if result.UseMultimodal {
+		servingRoute = multimodalRoute
+	}
+	recordRouteRequest(servingRoute, originalModel)
+
 	if result.IsAnthropic {
-		handleAnthropicRequest(w, result.AnthropicRequest)
+		handleAnthropicRequest(w, &anthropicReq, route, result)
 		return
 	}
 
-	openaiBody, err := json.Marshal(result.OpenAIRequest)
+	requestStartTime := time.Now()
+	resp, result, err := sendWithContextRecovery(r, &anthropicReq, route, servingRoute, result)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, upstreamRequestError(err))
 		return
 	}
+	defer resp.Body.Close()
 
-	targetURL := backendURL
-	if result.UseMultimodal {
-		targetURL = multimodalURL
-	}
-
-	req, err := http.NewRequest(http.MethodPost, targetURL+"/chat/completions", bytes.NewReader(openaiBody))
-	if err != nil {
-		writeError(w, err)
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := translateUpstreamError(resp.StatusCode, body)
+		addLog(fmt.Sprintf("[✗] Upstream %d -> %s: %s", resp.StatusCode, apiErr.Type, apiErr.Message))
+		writeAPIError(w, apiErr)
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	apiKey := resolveAPIKey(r, result.UseMultimodal)
-	if apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+	if anthropicReq.Stream {
+		handleStreamingResponse(w, resp, originalModel, requestStartTime, result.Interceptor, estimateOpenAIRequestTokens(result.OpenAIRequest))
+	} else {
+		handleNonStreamingResponse(w, resp, originalModel, result.Interceptor)
 	}
+}
 
-	client := &http.Client{}
-	requestStartTime := time.Now()
-	resp, err := client.Do(req)
+func handleAnthropicRequest(w http.ResponseWriter, anthropicReq *AnthropicRequest, route *Route, result *ConvertResult) {
+	resp, err := sendAnthropicWithContextRecovery(anthropicReq, route, result)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, upstreamRequestError(err))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		w.Write(body)
+		if isAnthropicErrorBody(body) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(resp.StatusCode)
+			w.Write(body)
+			return
+		}
+		writeAPIError(w, translateUpstreamError(resp.StatusCode, body))
 		return
 	}
 
-	if anthropicReq.Stream {
-		handleStreamingResponse(w, resp, originalModel, requestStartTime)
-	} else {
-		handleNonStreamingResponse(w, resp, originalModel)
+	for h, v := range resp.Header {
+		lower := strings.ToLower(h)
+		if lower != "connection" && lower != "transfer-encoding" {
+			w.Header()[h] = v
+		}
 	}
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
 }
 
-func handleAnthropicRequest(w http.ResponseWriter, anthropicReq *AnthropicRequest) {
+func sendAnthropicRequest(anthropicReq *AnthropicRequest) (*http.Response, error) {
 	reqBody, err := json.Marshal(anthropicReq)
 	if err != nil {
-		writeError(w, err)
-		return
+		return nil, err
 	}
 
 	req, err := http.NewRequest(http.MethodPost, multimodalURL+"/v1/messages", bytes.NewReader(reqBody))
 	if err != nil {
-		writeError(w, err)
-		return
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -119,22 +130,7 @@ func handleAnthropicRequest(w http.ResponseWriter, anthropicReq *AnthropicReques
 	req.Header.Set("anthropic-version", "2023-06-01")
 
 	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		writeError(w, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	for h, v := range resp.Header {
-		lower := strings.ToLower(h)
-		if lower != "connection" && lower != "transfer-encoding" {
-			w.Header()[h] = v
-		}
-	}
-
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	return client.Do(req)
 }
 
 func countTokensHandler(w http.ResponseWriter, r *http.Request) {
@@ -154,8 +150,17 @@ func countTokensHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	textLength := len(body)
-	estimatedTokens := (textLength + 3) / 4
+	var anthropicReq AnthropicRequest
+	if err := json.Unmarshal(body, &anthropicReq); err != nil {
+		writeError(w, invalidRequestError(err))
+		return
+	}
+
+	estimatedTokens, err := countRequestTokens(&anthropicReq)
+	if err != nil {
+		writeError(w, invalidRequestError(err))
+		return
+	}
 
 	response := CountTokensResponse{
 		InputTokens: estimatedTokens,
@@ -181,9 +186,16 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 	currentPromptTokens := totalPromptTokens
 	currentCompletionTokens := totalCompletionTokens
 	currentCachedTokens := totalCachedTokens
+	currentCacheCreationTokens := totalCacheCreationTokens
 	currentTotalTokens := totalTokens
+	currentLastRoute := lastRouteName
 	statsMu.RUnlock()
 
+	var cacheHitRate float64
+	if currentPromptTokens > 0 {
+		cacheHitRate = float64(currentCachedTokens) / float64(currentPromptTokens) * 100
+	}
+
 	metricsMu.RLock()
 	instantFirstTokenLatency := lastFirstTokenLatency
 	instantTokenThroughput := lastTokenThroughput
@@ -208,12 +220,18 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 		"tokencount":  tokenCount,
 		"multimodal":  multimodalURL != "",
 		"keeprounds":  keepRounds,
+		"cacheStep":   compressStepTokens,
+		"budget":      contextBudget,
+		"routes":      routeStatus(),
+		"lastRoute":   currentLastRoute,
 		"startupTime": startupTime.Format("2006-01-02 15:04:05"),
 		"logs":        logsCopy,
-		"stats": map[string]int64{
+		"stats": map[string]any{
 			"promptTokens":     currentPromptTokens,
 			"completionTokens": currentCompletionTokens,
 			"cachedTokens":     currentCachedTokens,
+			"cacheWriteTokens": currentCacheCreationTokens,
+			"cacheHitRate":     cacheHitRate,
 			"totalTokens":      currentTotalTokens,
 		},
 		"metrics": map[string]any{
@@ -244,13 +262,44 @@ func shutdownHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func proxyCountTokens(w http.ResponseWriter, body []byte) {
-	var req map[string]any
-	if err := json.Unmarshal(body, &req); err != nil {
-		writeError(w, err)
+	var anthropicReq AnthropicRequest
+	if err := json.Unmarshal(body, &anthropicReq); err != nil {
+		writeError(w, invalidRequestError(err))
 		return
 	}
 
-	req["model"] = anthropicModel
+	ctx := &ConvertContext{
+		Route:         resolveRoute(anthropicReq.Model),
+		UseMultimodal: useMultimodalRoute(&anthropicReq),
+		Quiet:         true,
+	}
+	preprocessed, err := preprocessAnthropicRequest(&anthropicReq, ctx)
+	if err != nil {
+		writeError(w, invalidRequestError(err))
+		return
+	}
+
+	req := map[string]any{
+		"model":    anthropicModel,
+		"messages": preprocessed.Messages,
+	}
+	if preprocessed.System != nil {
+		req["system"] = preprocessed.System
+	}
+	if len(preprocessed.Tools) > 0 {
+		req["tools"] = preprocessed.Tools
+	}
+	if preprocessed.ToolChoice != nil {
+		req["tool_choice"] = preprocessed.ToolChoice
+	}
+
+	hashes := prefixHashes([]any{"anthropic", anthropicModel, preprocessed.System, preprocessed.Tools}, preprocessed.Messages)
+	if cached, ok := cachedAnthropicCount(hashes, preprocessed.Messages); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(CountTokensResponse{InputTokens: cached})
+		return
+	}
 
 	newBody, err := json.Marshal(req)
 	if err != nil {
@@ -271,7 +320,7 @@ func proxyCountTokens(w http.ResponseWriter, body []byte) {
 	client := &http.Client{}
 	resp, err := client.Do(proxyReq)
 	if err != nil {
-		writeError(w, err)
+		writeError(w, upstreamRequestError(err))
 		return
 	}
 	defer resp.Body.Close()
@@ -282,17 +331,41 @@ func proxyCountTokens(w http.ResponseWriter, body []byte) {
 		return
 	}
 
+	if resp.StatusCode == http.StatusOK && len(hashes) > 0 {
+		var counted CountTokensResponse
+		if err := json.Unmarshal(respBody, &counted); err == nil && counted.InputTokens > 0 {
+			storeTokenCount(hashes[len(hashes)-1], counted.InputTokens)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(resp.StatusCode)
 	w.Write(respBody)
 }
 
-func resolveAPIKey(r *http.Request, useMultimodal bool) string {
-	if useMultimodal {
-		return multimodalAPIKey
+func cachedAnthropicCount(hashes []string, messages []AnthropicMessage) (int, bool) {
+	start, count := longestCachedPrefix(hashes)
+	if start < 0 {
+		return 0, false
+	}
+	if start == len(hashes)-1 {
+		return count, true
+	}
+
+	counter := tokenCounterForModel(anthropicModel)
+	drift := 0
+	for i := start + 1; i < len(messages); i++ {
+		drift += estimateAnthropicMessageTokens(counter, messages[i])
 	}
-	if backendAPIKey != "" {
-		return backendAPIKey
+	if drift > maxCountCacheDrift {
+		return 0, false
+	}
+	return count + drift, true
+}
+
+func resolveAPIKey(r *http.Request, backend *Backend) string {
+	if backend.APIKey != "" {
+		return backend.APIKey
 	}
 	if key := r.Header.Get("x-api-key"); key != "" {
 		return key
@@ -302,14 +375,3 @@ func resolveAPIKey(r *http.Request, useMultimodal bool) string {
 	}
 	return ""
 }
-
-func writeError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
-	json.NewEncoder(w).Encode(map[string]any{
-		"error": map[string]any{
-			"type":    "api_error",
-			"message": err.Error(),
-		},
-	})
-}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"sync"
+)
+
+const (
+	maxShrunkImages = 64
+	maxDecodePixels = 50 << 20
+)
+
+var (
+	maxImageSide   = 2048
+	maxImagePixels = 4 << 20
+	jpegQuality    = 85
+	jpegMinBytes   = 512 << 10
+	shrunkImages   = make(map[string]shrunkImage)
+	shrunkImagesMu sync.Mutex
+)
+
+type shrunkImage struct {
+	mediaType string
+	data      string
+}
+
+func shrinkBase64Image(mediaType, data string) (string, string) {
+	if maxImageSide <= 0 && maxImagePixels <= 0 && jpegQuality <= 0 {
+		return mediaType, data
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	key := hex.EncodeToString(sum[:])
+
+	shrunkImagesMu.Lock()
+	cached, ok := shrunkImages[key]
+	shrunkImagesMu.Unlock()
+	if ok {
+		return cached.mediaType, cached.data
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return mediaType, data
+	}
+	result := shrunkImage{mediaType: mediaType, data: data}
+	if newType, newData, ok := shrinkImage(raw); ok {
+		result = shrunkImage{mediaType: newType, data: base64.StdEncoding.EncodeToString(newData)}
+	}
+
+	shrunkImagesMu.Lock()
+	if len(shrunkImages) >= maxShrunkImages {
+		shrunkImages = make(map[string]shrunkImage)
+	}
+	shrunkImages[key] = result
+	shrunkImagesMu.Unlock()
+	return result.mediaType, result.data
+}
+
+func shrinkImage(data []byte) (string, []byte, bool) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return "", nil, false
+	}
+
+	width, height := config.Width, config.Height
+	if width*height > maxDecodePixels {
+		addLog(fmt.Sprintf("[Image] %s %dx%d is too large to decode, sent unchanged", format, width, height))
+		return "", nil, false
+	}
+	scale := 1.0
+	if longest := max(width, height); maxImageSide > 0 && longest > maxImageSide {
+		scale = float64(maxImageSide) / float64(longest)
+	}
+	if pixels := float64(width) * float64(height) * scale * scale; maxImagePixels > 0 && pixels > float64(maxImagePixels) {
+		scale = math.Sqrt(float64(maxImagePixels) / (float64(width) * float64(height)))
+	}
+	resize := scale < 1
+	toJPEG := format == "png" && jpegQuality > 0 && len(data) > jpegMinBytes
+	if !resize && !toJPEG {
+		return "", nil, false
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, false
+	}
+	if resize {
+		img = resizeImage(img, max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale)))
+	}
+
+	var buf bytes.Buffer
+	mediaType := "image/png"
+	if toJPEG || format == "jpeg" {
+		quality := jpegQuality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+		mediaType = "image/jpeg"
+		err = jpeg.Encode(&buf, flattenImage(img), &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil || (!resize && buf.Len() >= len(data)) {
+		return "", nil, false
+	}
+
+	bounds := img.Bounds()
+	addLog(fmt.Sprintf("[Image] %s %dx%d %d KB -> %s %dx%d %d KB", format, width, height, len(data)>>10,
+		mediaType[len("image/"):], bounds.Dx(), bounds.Dy(), buf.Len()>>10))
+	return mediaType, buf.Bytes(), true
+}
+
+func resizeImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	pixel := pixelReader(src)
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := pixel(bounds.Min.X+sx, bounds.Min.Y+sy)
+					r += pr
+					g += pg
+					b += pb
+					a += pa
+					n++
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// pixelReader returns premultiplied 8-bit RGBA values, reading the decoder's
+// own pixel layout directly for the common formats.
+func pixelReader(src image.Image) func(x, y int) (r, g, b, a uint32) {
+	switch img := src.(type) {
+	case *image.RGBA:
+		return func(x, y int) (r, g, b, a uint32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			return uint32(p[0]), uint32(p[1]), uint32(p[2]), uint32(p[3])
+		}
+	case *image.NRGBA:
+		return func(x, y int) (r, g, b, a uint32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			a = uint32(p[3])
+			return uint32(p[0]) * a / 255, uint32(p[1]) * a / 255, uint32(p[2]) * a / 255, a
+		}
+	case *image.YCbCr:
+		return func(x, y int) (r, g, b, a uint32) {
+			cr, cg, cb := color.YCbCrToRGB(img.Y[img.YOffset(x, y)], img.Cb[img.COffset(x, y)], img.Cr[img.COffset(x, y)])
+			return uint32(cr), uint32(cg), uint32(cb), 255
+		}
+	}
+	return func(x, y int) (r, g, b, a uint32) {
+		r, g, b, a = src.At(x, y).RGBA()
+		return r >> 8, g >> 8, b >> 8, a >> 8
+	}
+}
+
+func flattenImage(src image.Image) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
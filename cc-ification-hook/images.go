@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const maxFetchBytes = 20 << 20
+
+var (
+	multimodalRemoteImages = true
+	imageClient            = &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: rejectInternalAddress}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+func (ctx *ConvertContext) imageURL(block map[string]any) (string, error) {
+	return imageSourceURL(block, multimodalRemoteImages || ctx.Quiet, !ctx.Quiet)
+}
+
+func validateImageSource(block map[string]any) error {
+	source, ok := block["source"].(map[string]any)
+	if !ok {
+		return invalidRequestError(fmt.Errorf("image block has no source"))
+	}
+	switch source["type"] {
+	case "base64", "url":
+		return nil
+	case "file":
+		return invalidRequestError(fmt.Errorf("image source type \"file\" is not supported by this proxy, send the image as base64 or url"))
+	}
+	return invalidRequestError(fmt.Errorf("unsupported image source type %q", source["type"]))
+}
+
+func imageSourceURL(block map[string]any, remote bool, shrink bool) (string, error) {
+	if err := validateImageSource(block); err != nil {
+		return "", err
+	}
+	source := block["source"].(map[string]any)
+
+	if source["type"] == "base64" {
+		mediaType, _ := source["media_type"].(string)
+		data, _ := source["data"].(string)
+		if mediaType == "" || data == "" {
+			return "", invalidRequestError(fmt.Errorf("base64 image source requires media_type and data"))
+		}
+		if shrink {
+			mediaType, data = shrinkBase64Image(mediaType, data)
+		}
+		return fmt.Sprintf("data:%s;base64,%s", mediaType, data), nil
+	}
+
+	url, _ := source["url"].(string)
+	if url == "" {
+		return "", invalidRequestError(fmt.Errorf("url image source requires url"))
+	}
+	if remote {
+		return url, nil
+	}
+	return fetchImageDataURL(url, shrink)
+}
+
+func (ctx *ConvertContext) shrinkImage(block map[string]any) map[string]any {
+	if ctx.Quiet {
+		return block
+	}
+	return shrinkImageBlock(block)
+}
+
+func shrinkImageBlock(block map[string]any) map[string]any {
+	source, ok := block["source"].(map[string]any)
+	if !ok || source["type"] != "base64" {
+		return block
+	}
+	mediaType, _ := source["media_type"].(string)
+	data, _ := source["data"].(string)
+	newType, newData := shrinkBase64Image(mediaType, data)
+	if newData == data {
+		return block
+	}
+	return copyBlock(block, "source", map[string]any{"type": "base64", "media_type": newType, "data": newData})
+}
+
+func fetchImageDataURL(url string, shrink bool) (string, error) {
+	data, mediaType, err := fetchRemote(url, "image")
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", invalidRequestError(fmt.Errorf("url %s is not an image (%s)", url, mediaType))
+	}
+	if shrink {
+		if newType, newData, ok := shrinkImage(data); ok {
+			mediaType, data = newType, newData
+		}
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func fetchRemote(url string, kind string) ([]byte, string, error) {
+	if err := checkFetchURL(url); err != nil {
+		return nil, "", invalidRequestError(fmt.Errorf("refusing to fetch %s %s: %v", kind, url, err))
+	}
+	resp, err := imageClient.Get(url)
+	if err != nil {
+		return nil, "", invalidRequestError(fmt.Errorf("failed to fetch %s %s: %v", kind, url, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, "", invalidRequestError(fmt.Errorf("failed to fetch %s %s: HTTP %d", kind, url, resp.StatusCode))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes+1))
+	if err != nil {
+		return nil, "", invalidRequestError(fmt.Errorf("failed to fetch %s %s: %v", kind, url, err))
+	}
+	if len(data) > maxFetchBytes {
+		return nil, "", invalidRequestError(fmt.Errorf("%s %s exceeds %d MB", kind, url, maxFetchBytes>>20))
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return data, strings.TrimSpace(mediaType), nil
+}
+
+func checkFetchURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("scheme %q is not allowed", parsed.Scheme)
+	}
+	return nil
+}
+
+func rejectInternalAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("address %s is not allowed", host)
+	}
+	return nil
+}
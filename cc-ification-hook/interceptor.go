@@ -1,36 +1,93 @@
 package main
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Keeps parsed tool calls clear of the backend's own tool_call indexes.
+const interceptedToolIndexBase = 1000
+
 type Interceptor interface {
+	OnRequest(req *OpenAIRequest)
 	OnMessage(msg *AnthropicMessage)
 	OnDeltaStart(delta *OpenAIDelta)
+	OnStreamEnd(delta *OpenAIDelta)
 }
 
 type InterceptorFactory interface {
+	Name() string
 	ShouldIntercept(backendURL string) bool
 	Create() Interceptor
 }
 
 var interceptorFactories []InterceptorFactory
-var interceptor Interceptor
 
 func RegisterInterceptorFactory(factory InterceptorFactory) {
 	interceptorFactories = append(interceptorFactories, factory)
 }
 
-func InitInterceptor() {
-	for _, factory := range interceptorFactories {
-		if factory.ShouldIntercept(backendURL) {
-			interceptor = factory.Create()
-			return
-		}
+func CreateInterceptor(route *Route, backendURL string) Interceptor {
+	if factory := interceptorFactoryFor(route, backendURL); factory != nil {
+		return factory.Create()
 	}
+	return nil
 }
 
-func CreateStreamInterceptor() Interceptor {
+func interceptorFactoryFor(route *Route, backendURL string) InterceptorFactory {
 	for _, factory := range interceptorFactories {
+		if route.Interceptor != "" {
+			if factory.Name() == route.Interceptor {
+				return factory
+			}
+			continue
+		}
 		if factory.ShouldIntercept(backendURL) {
-			return factory.Create()
+			return factory
 		}
 	}
 	return nil
 }
+
+func newToolCallID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
+
+type tagSplitter struct {
+	buffer    string
+	trimStart bool
+}
+
+// next returns the text before tag, holding back a partial tag when tag is not found.
+func (s *tagSplitter) next(tag string) (string, bool) {
+	i := strings.Index(s.buffer, tag)
+	if i < 0 {
+		n := safePrefixLen(s.buffer, tag)
+		text := s.trimLeading(s.buffer[:n])
+		s.buffer = s.buffer[n:]
+		return text, false
+	}
+	text := s.trimLeading(s.buffer[:i])
+	s.buffer = s.buffer[i+len(tag):]
+	return text, true
+}
+
+func (s *tagSplitter) flush() string {
+	text := s.trimLeading(s.buffer)
+	s.buffer = ""
+	return text
+}
+
+func (s *tagSplitter) trimLeading(text string) string {
+	if !s.trimStart {
+		return text
+	}
+	text = strings.TrimLeft(text, " \t\r\n")
+	if text != "" {
+		s.trimStart = false
+	}
+	return text
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const emulatedToolsPrompt = `# Tools
+
+You can call the tools listed below. To call a tool, reply with exactly this format:
+<tool_call>
+{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}
+</tool_call>
+
+Rules:
+- Put each call in its own <tool_call> block. The content must be a single valid JSON object matching the tool's parameters.
+- You may make several calls in one reply. Stop right after the last </tool_call> and wait.
+- The results come back in the next user message inside <tool_result> blocks. Never write <tool_result> yourself or guess a result.
+- Only call tools from the list.
+
+<tools>
+%s
+</tools>`
+
+type EmulateInterceptorFactory struct{}
+
+func (f *EmulateInterceptorFactory) Name() string {
+	return "emulate"
+}
+
+func (f *EmulateInterceptorFactory) ShouldIntercept(backendURL string) bool {
+	return false
+}
+
+func (f *EmulateInterceptorFactory) Create() Interceptor {
+	return &EmulateInterceptor{}
+}
+
+type EmulateInterceptor struct {
+	HermesInterceptor
+}
+
+func (e *EmulateInterceptor) OnRequest(req *OpenAIRequest) {
+	toolNames := make(map[string]string)
+	var messages []OpenAIMessage
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			msg.Content = emulatedAssistantContent(msg)
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+			}
+			msg.ToolCalls = nil
+		case msg.Role == "tool":
+			msg = OpenAIMessage{Role: "user", Content: emulatedToolResult(toolNames[msg.ToolCallID], msg.Content)}
+		}
+
+		if n := len(messages); n > 0 && msg.Role == "user" && messages[n-1].Role == "user" {
+			parts := append(contentParts(messages[n-1].Content), OpenAIContentPart{Type: "text", Text: "\n\n"})
+			messages[n-1].Content = joinContentParts(append(parts, contentParts(msg.Content)...))
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	req.Messages = messages
+
+	if len(req.Tools) > 0 {
+		addSystemText(req, emulatedToolsSystemText(req.Tools, req.ToolChoice))
+		// Keep the model from inventing the result of its own call.
+		if len(req.Stop) < 4 {
+			req.Stop = append(req.Stop, "<tool_result")
+		}
+	}
+	req.Tools = nil
+	req.ToolChoice = nil
+}
+
+func emulatedAssistantContent(msg OpenAIMessage) string {
+	var sb strings.Builder
+	if text, _ := msg.Content.(string); text != "" {
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	for _, tc := range msg.ToolCalls {
+		args := tc.Function.Arguments
+		if !json.Valid([]byte(args)) {
+			args = "{}"
+		}
+		name, _ := json.Marshal(tc.Function.Name)
+		fmt.Fprintf(&sb, "%s\n{\"name\": %s, \"arguments\": %s}\n%s\n", toolCallStart, name, args, toolCallEnd)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func emulatedToolResult(name string, content any) any {
+	open := "<tool_result>\n"
+	if name != "" {
+		open = fmt.Sprintf("<tool_result name=%q>\n", name)
+	}
+	parts := append([]OpenAIContentPart{{Type: "text", Text: open}}, contentParts(content)...)
+	return joinContentParts(append(parts, OpenAIContentPart{Type: "text", Text: "\n</tool_result>"}))
+}
+
+func emulatedToolsSystemText(tools []OpenAITool, toolChoice any) string {
+	var lines []string
+	for _, tool := range tools {
+		line, _ := json.Marshal(tool.Function)
+		lines = append(lines, string(line))
+	}
+	text := fmt.Sprintf(emulatedToolsPrompt, strings.Join(lines, "\n"))
+
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "required":
+			text += "\n\nYou must call at least one tool in this reply."
+		case "none":
+			text += "\n\nDo not call any tools in this reply."
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			text += fmt.Sprintf("\n\nYou must call the %v tool in this reply.", function["name"])
+		}
+	}
+	return text
+}
+
+func addSystemText(req *OpenAIRequest, text string) {
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		parts := append(contentParts(req.Messages[0].Content), OpenAIContentPart{Type: "text", Text: "\n\n" + text})
+		req.Messages[0].Content = joinContentParts(parts)
+		return
+	}
+	system := OpenAIMessage{Role: "system", Content: text}
+	req.Messages = append([]OpenAIMessage{system}, req.Messages...)
+}
+
+func contentParts(content any) []OpenAIContentPart {
+	switch v := content.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []OpenAIContentPart{{Type: "text", Text: v}}
+	case []OpenAIContentPart:
+		return v
+	case []any:
+		var parts []OpenAIContentPart
+		for _, item := range v {
+			if part, ok := item.(OpenAIContentPart); ok {
+				parts = append(parts, part)
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// A cache marker stays on the text it ended.
+func joinContentParts(parts []OpenAIContentPart) any {
+	var joined []OpenAIContentPart
+	for _, part := range parts {
+		if n := len(joined); n > 0 && part.Type == "text" && joined[n-1].Type == "text" && joined[n-1].CacheControl == nil {
+			joined[n-1].Text += part.Text
+			joined[n-1].CacheControl = part.CacheControl
+			continue
+		}
+		joined = append(joined, part)
+	}
+	return contentPartsToAny(joined)
+}
+
+func init() {
+	RegisterInterceptorFactory(&EmulateInterceptorFactory{})
+}
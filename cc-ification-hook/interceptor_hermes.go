@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type HermesInterceptorFactory struct{}
+
+func (f *HermesInterceptorFactory) Name() string {
+	return "hermes"
+}
+
+func (f *HermesInterceptorFactory) ShouldIntercept(backendURL string) bool {
+	return false
+}
+
+func (f *HermesInterceptorFactory) Create() Interceptor {
+	return &HermesInterceptor{}
+}
+
+type HermesInterceptor struct {
+	tagSplitter
+	think  ThinkInterceptor
+	inCall bool
+	calls  int
+}
+
+func (h *HermesInterceptor) OnRequest(req *OpenAIRequest) {}
+
+func (h *HermesInterceptor) OnMessage(msg *AnthropicMessage) {}
+
+func (h *HermesInterceptor) OnStreamEnd(delta *OpenAIDelta) {
+	h.think.OnStreamEnd(delta)
+	h.splitToolCalls(delta)
+	if h.inCall {
+		delta.Content += toolCallStart + h.buffer
+		h.buffer = ""
+		h.inCall = false
+		return
+	}
+	delta.Content += h.flush()
+}
+
+func (h *HermesInterceptor) OnDeltaStart(delta *OpenAIDelta) {
+	h.think.OnDeltaStart(delta)
+	h.splitToolCalls(delta)
+}
+
+func (h *HermesInterceptor) splitToolCalls(delta *OpenAIDelta) {
+	if delta.Content == "" {
+		return
+	}
+
+	h.buffer += delta.Content
+	var text strings.Builder
+	for {
+		if !h.inCall {
+			released, found := h.next(toolCallStart)
+			text.WriteString(released)
+			if !found {
+				break
+			}
+			h.inCall = true
+			continue
+		}
+
+		i := strings.Index(h.buffer, toolCallEnd)
+		if i < 0 {
+			break
+		}
+		body := h.buffer[:i]
+		h.buffer = h.buffer[i+len(toolCallEnd):]
+		h.inCall = false
+
+		if tc, ok := h.parseToolCall(body); ok {
+			delta.ToolCalls = append(delta.ToolCalls, tc)
+			h.trimStart = true
+			addLog(fmt.Sprintf("[Hermes] Parsed tool_call: %s(%s)", tc.Function.Name, tc.Function.Arguments))
+		} else {
+			text.WriteString(toolCallStart + body + toolCallEnd)
+		}
+	}
+	delta.Content = text.String()
+}
+
+func (h *HermesInterceptor) parseToolCall(body string) (OpenAIToolCall, bool) {
+	var call struct {
+		Name       string          `json:"name"`
+		Arguments  json.RawMessage `json:"arguments"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(body)), &call); err != nil || call.Name == "" {
+		return OpenAIToolCall{}, false
+	}
+
+	args := call.Arguments
+	if len(args) == 0 {
+		args = call.Parameters
+	}
+	var encoded string
+	if err := json.Unmarshal(args, &encoded); err == nil {
+		args = json.RawMessage(encoded)
+	}
+	var input map[string]any
+	if err := json.Unmarshal(args, &input); err != nil || input == nil {
+		args = json.RawMessage("{}")
+	}
+
+	tc := OpenAIToolCall{
+		Index: interceptedToolIndexBase + h.calls,
+		ID:    newToolCallID(),
+		Type:  "function",
+		Function: ToolCallFunction{
+			Name:      call.Name,
+			Arguments: string(args),
+		},
+	}
+	h.calls++
+	return tc, true
+}
+
+func init() {
+	RegisterInterceptorFactory(&HermesInterceptorFactory{})
+}
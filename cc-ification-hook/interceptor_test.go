@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type interceptedStream struct {
+	content   string
+	reasoning string
+	calls     []OpenAIToolCall
+}
+
+func runInterceptor(ic Interceptor, chunks []OpenAIDelta) interceptedStream {
+	var out interceptedStream
+	collect := func(delta *OpenAIDelta) {
+		out.content += delta.Content
+		out.reasoning += delta.Reasoning + delta.ReasoningContent
+		out.calls = append(out.calls, delta.ToolCalls...)
+	}
+	for _, chunk := range chunks {
+		delta := chunk
+		ic.OnDeltaStart(&delta)
+		collect(&delta)
+	}
+	var delta OpenAIDelta
+	ic.OnStreamEnd(&delta)
+	collect(&delta)
+	return out
+}
+
+// splits returns payload whole, cut in two at every byte offset, and one byte per chunk.
+func splits(payload string) [][]string {
+	result := [][]string{{payload}}
+	for i := 1; i < len(payload); i++ {
+		result = append(result, []string{payload[:i], payload[i:]})
+	}
+	var bytewise []string
+	for i := 0; i < len(payload); i++ {
+		bytewise = append(bytewise, payload[i:i+1])
+	}
+	return append(result, bytewise)
+}
+
+func contentDeltas(chunks []string) []OpenAIDelta {
+	deltas := make([]OpenAIDelta, len(chunks))
+	for i, chunk := range chunks {
+		deltas[i].Content = chunk
+	}
+	return deltas
+}
+
+func TestThinkInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		implicitStart bool
+		payload       string
+		wantContent   string
+		wantReasoning string
+	}{
+		{"tagged", true, "<think>\nplan\n</think>\n\nanswer", "answer", "plan\n"},
+		{"leading whitespace", true, " \n<think>plan</think>answer", "answer", "plan"},
+		{"bare end tag", true, "reason only</think>\n\nanswer", "answer", "reason only"},
+		{"tag after answer starts", false, "answer <think>quoted</think> tail", "answer <think>quoted</think> tail", ""},
+		{"second think block", true, "<think>a</think>b<think>c</think>", "b<think>c</think>", "a"},
+		{"unclosed think", true, "<think>plan", "", "plan"},
+		{"no end tag", true, "plain answer", "plain answer", "plain answer"},
+		{"no end tag, explicit only", false, "plain answer", "plain answer", ""},
+		{"partial tag at end", false, "<thi", "<thi", ""},
+	}
+
+	for _, tt := range tests {
+		for _, chunks := range splits(tt.payload) {
+			got := runInterceptor(&ThinkInterceptor{implicitStart: tt.implicitStart}, contentDeltas(chunks))
+			if got.content != tt.wantContent || got.reasoning != tt.wantReasoning {
+				t.Errorf("%s: chunks %q: got content %q, reasoning %q; want %q, %q",
+					tt.name, chunks, got.content, got.reasoning, tt.wantContent, tt.wantReasoning)
+			}
+		}
+	}
+}
+
+func TestThinkInterceptorIsOptIn(t *testing.T) {
+	for _, url := range []string{"http://localhost:11434/v1", "http://127.0.0.1:1234/v1", "https://api.openai.com/v1"} {
+		if (&ThinkInterceptorFactory{}).ShouldIntercept(url) {
+			t.Errorf("ShouldIntercept(%q) = true, want false", url)
+		}
+	}
+}
+
+type wantToolCall struct {
+	name string
+	args string
+}
+
+// checkToolCalls merges streamed fragments by index and compares them with want.
+func checkToolCalls(t *testing.T, label string, calls []OpenAIToolCall, want []wantToolCall) {
+	t.Helper()
+	var merged []OpenAIToolCall
+	for _, call := range calls {
+		if call.ID != "" {
+			merged = append(merged, call)
+			continue
+		}
+		if len(merged) == 0 || merged[len(merged)-1].Index != call.Index {
+			t.Errorf("%s: argument fragment for index %d without an open call", label, call.Index)
+			return
+		}
+		merged[len(merged)-1].Function.Arguments += call.Function.Arguments
+	}
+	if len(merged) != len(want) {
+		t.Errorf("%s: got %d tool calls %+v, want %d", label, len(merged), merged, len(want))
+		return
+	}
+	ids := make(map[string]bool)
+	for i, call := range merged {
+		if call.Index != interceptedToolIndexBase+i {
+			t.Errorf("%s: call %d has index %d, want %d", label, i, call.Index, interceptedToolIndexBase+i)
+		}
+		if ids[call.ID] {
+			t.Errorf("%s: call %d reuses ID %s", label, i, call.ID)
+		}
+		ids[call.ID] = true
+		var got, expected any
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &got); err != nil {
+			t.Errorf("%s: call %d arguments %q are not JSON: %v", label, i, call.Function.Arguments, err)
+			continue
+		}
+		json.Unmarshal([]byte(want[i].args), &expected)
+		if call.Function.Name != want[i].name || !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: call %d = %s(%s), want %s(%s)", label, i, call.Function.Name, call.Function.Arguments, want[i].name, want[i].args)
+		}
+	}
+}
+
+func TestHermesInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		wantContent   string
+		wantReasoning string
+		wantCalls     []wantToolCall
+	}{
+		{"text only", "just text", "just text", "", nil},
+		{"think and call", "<think>plan</think>Reading. <tool_call>{\"name\":\"Read\",\"arguments\":{\"path\":\"a.go\"}}</tool_call>",
+			"Reading. ", "plan", []wantToolCall{{"Read", `{"path":"a.go"}`}}},
+		{"two calls in a row", "<tool_call>{\"name\":\"Read\",\"arguments\":{\"path\":\"a\"}}</tool_call>\n<tool_call>{\"name\":\"Read\",\"arguments\":{\"path\":\"b\"}}</tool_call>",
+			"", "", []wantToolCall{{"Read", `{"path":"a"}`}, {"Read", `{"path":"b"}`}}},
+		{"escaped JSON", `<tool_call>{"name":"Bash","arguments":{"command":"echo \"a\\tb\" \u003c x"}}</tool_call>`,
+			"", "", []wantToolCall{{"Bash", `{"command":"echo \"a\\tb\" < x"}`}}},
+		{"arguments as a JSON string", `<tool_call>{"name":"Bash","arguments":"{\"command\":\"ls \\\"x\\\"\"}"}</tool_call>`,
+			"", "", []wantToolCall{{"Bash", `{"command":"ls \"x\""}`}}},
+		{"parameters", `<tool_call>{"name":"Ping","parameters":{}}</tool_call>`, "", "", []wantToolCall{{"Ping", `{}`}}},
+		{"unclosed call", `ok <tool_call>{"name":"Read"`, `ok <tool_call>{"name":"Read"`, "", nil},
+		{"invalid call", "<tool_call>not json</tool_call> rest", "<tool_call>not json</tool_call> rest", "", nil},
+	}
+
+	for _, tt := range tests {
+		for _, chunks := range splits(tt.payload) {
+			label := tt.name + ": chunks " + string(mustJSON(chunks))
+			got := runInterceptor(&HermesInterceptor{}, contentDeltas(chunks))
+			if got.content != tt.wantContent || got.reasoning != tt.wantReasoning {
+				t.Errorf("%s: got content %q, reasoning %q; want %q, %q", label, got.content, got.reasoning, tt.wantContent, tt.wantReasoning)
+			}
+			checkToolCalls(t, label, got.calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestZhipuInterceptor(t *testing.T) {
+	req := &OpenAIRequest{Tools: []OpenAITool{
+		{Type: "function", Function: ToolFunction{Name: "Read", Parameters: map[string]any{
+			"properties": map[string]any{"path": map[string]any{"type": "string"}},
+		}}},
+		{Type: "function", Function: ToolFunction{Name: "Bash", Parameters: map[string]any{
+			"properties": map[string]any{"command": map[string]any{"type": "string"}, "timeout": map[string]any{"type": "number"}},
+		}}},
+		{Type: "function", Function: ToolFunction{Name: "Edit", Parameters: map[string]any{
+			"properties": map[string]any{"opts": map[string]any{"type": "object"}},
+		}}},
+	}}
+	tests := []struct {
+		name          string
+		payload       string
+		wantReasoning string
+		wantCalls     []wantToolCall
+	}{
+		{"text only", "thinking about it", "thinking about it", nil},
+		{"one call", "Let me read.<tool_call>Read\n<arg_key>path</arg_key>\n<arg_value>/tmp/a b.txt</arg_value>\n</tool_call>Done.",
+			"Let me read.Done.", []wantToolCall{{"Read", `{"path":"/tmp/a b.txt"}`}}},
+		{"two calls in a row", "<tool_call>Read\n<arg_key>path</arg_key><arg_value>a</arg_value></tool_call><tool_call>Read\n<arg_key>path</arg_key><arg_value>b</arg_value></tool_call>",
+			"", []wantToolCall{{"Read", `{"path":"a"}`}, {"Read", `{"path":"b"}`}}},
+		{"string and number", "<tool_call>Bash\n<arg_key>command</arg_key><arg_value>ls -la</arg_value>\n<arg_key>timeout</arg_key><arg_value>30</arg_value></tool_call>",
+			"", []wantToolCall{{"Bash", `{"command":"ls -la","timeout":30}`}}},
+		{"escaped string value", "<tool_call>Bash\n<arg_key>command</arg_key><arg_value>echo \"a\\tb\"\nprintf '%s' \"</x>\"</arg_value></tool_call>",
+			"", []wantToolCall{{"Bash", `{"command":"echo \"a\\tb\"\nprintf '%s' \"</x>\""}`}}},
+		{"JSON value", `<tool_call>Edit
+<arg_key>opts</arg_key><arg_value>{"old":"a\"b","new":"c\\d"}</arg_value></tool_call>`,
+			"", []wantToolCall{{"Edit", `{"opts":{"old":"a\"b","new":"c\\d"}}`}}},
+		{"no arguments", "<tool_call>Ping\n</tool_call>", "", []wantToolCall{{"Ping", `{}`}}},
+		{"unclosed value", "<tool_call>Bash\n<arg_key>command</arg_key><arg_value>ls -la", "", []wantToolCall{{"Bash", `{"command":"ls -la"}`}}},
+		{"unclosed arguments", "<tool_call>Read\n<arg_key>path</arg_key><arg_value>a</arg_value>\n", "", []wantToolCall{{"Read", `{"path":"a"}`}}},
+		{"unclosed name", "text<tool_call>Rea", "text", nil},
+	}
+
+	for _, tt := range tests {
+		for _, chunks := range splits(tt.payload) {
+			label := tt.name + ": chunks " + string(mustJSON(chunks))
+			deltas := make([]OpenAIDelta, len(chunks))
+			for i, chunk := range chunks {
+				deltas[i].ReasoningContent = chunk
+			}
+			ic := &ZhipuInterceptor{}
+			ic.OnRequest(req)
+			got := runInterceptor(ic, deltas)
+			if got.content != "" || got.reasoning != tt.wantReasoning {
+				t.Errorf("%s: got content %q, reasoning %q; want \"\", %q", label, got.content, got.reasoning, tt.wantReasoning)
+			}
+			checkToolCalls(t, label, got.calls, tt.wantCalls)
+		}
+	}
+}
+
+func mustJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
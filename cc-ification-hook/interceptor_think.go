@@ -0,0 +1,108 @@
+package main
+
+import "strings"
+
+const (
+	thinkStart = "<think>"
+	thinkEnd   = "</think>"
+)
+
+type thinkState int
+
+const (
+	thinkPending thinkState = iota
+	thinkOpen
+	thinkImplicit
+	thinkDone
+)
+
+type ThinkInterceptorFactory struct{}
+
+func (f *ThinkInterceptorFactory) Name() string {
+	return "think"
+}
+
+func (f *ThinkInterceptorFactory) ShouldIntercept(backendURL string) bool {
+	return false
+}
+
+func (f *ThinkInterceptorFactory) Create() Interceptor {
+	return &ThinkInterceptor{implicitStart: true}
+}
+
+type ThinkInterceptor struct {
+	tagSplitter
+	state thinkState
+	// implicitStart treats output that does not open with <think> as reasoning,
+	// for chat templates (QwQ, DeepSeek-R1) that put the opening tag in the prompt.
+	implicitStart bool
+	implicit      strings.Builder
+}
+
+func (t *ThinkInterceptor) OnRequest(req *OpenAIRequest) {}
+
+func (t *ThinkInterceptor) OnMessage(msg *AnthropicMessage) {}
+
+func (t *ThinkInterceptor) OnStreamEnd(delta *OpenAIDelta) {
+	text := t.flush()
+	switch t.state {
+	case thinkOpen:
+		delta.ReasoningContent += text
+	case thinkImplicit:
+		// No </think> ever came, so the model did not reason after all: send the text as the answer too.
+		delta.ReasoningContent += text
+		delta.Content += t.implicit.String() + text
+	default:
+		delta.Content += text
+	}
+}
+
+func (t *ThinkInterceptor) OnDeltaStart(delta *OpenAIDelta) {
+	if delta.Content == "" {
+		return
+	}
+
+	t.buffer += delta.Content
+	delta.Content = ""
+	if t.state == thinkPending {
+		trimmed := strings.TrimLeft(t.buffer, " \t\r\n")
+		switch {
+		case strings.HasPrefix(trimmed, thinkStart):
+			t.buffer = trimmed[len(thinkStart):]
+			t.state = thinkOpen
+		case strings.HasPrefix(thinkStart, trimmed):
+			return
+		case t.implicitStart:
+			t.state = thinkImplicit
+		default:
+			t.state = thinkDone
+		}
+		t.trimStart = true
+	}
+
+	var reasoning string
+	if t.state == thinkOpen || t.state == thinkImplicit {
+		released, found := t.next(thinkEnd)
+		reasoning = released
+		if t.state == thinkImplicit {
+			t.implicit.WriteString(released)
+		}
+		if found {
+			t.state = thinkDone
+			t.trimStart = true
+		}
+	}
+	if t.state == thinkDone {
+		delta.Content = t.flush()
+	}
+
+	if delta.Reasoning != "" {
+		delta.Reasoning += reasoning
+	} else {
+		delta.ReasoningContent += reasoning
+	}
+}
+
+func init() {
+	RegisterInterceptorFactory(&ThinkInterceptorFactory{})
+}
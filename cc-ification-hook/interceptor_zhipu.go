@@ -5,17 +5,28 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"time"
+)
+
+const (
+	toolCallStart = "<tool_call>"
+	toolCallEnd   = "</tool_call>"
+	argKeyStart   = "<arg_key>"
+	argKeyEnd     = "</arg_key>"
+	argValueStart = "<arg_value>"
+	argValueEnd   = "</arg_value>"
 )
 
 var (
 	toolCallPattern = regexp.MustCompile(`<tool_call>([\s\S]*?)</tool_call>`)
-	argPairPattern  = regexp.MustCompile(`(?s)<arg_key>(.*?)</arg_key>\s*<arg_value>(.*?)</arg_value>`)
 	thinkingPattern = regexp.MustCompile(`(?s)<thinking>.*?</thinking>`)
 )
 
 type ZhipuInterceptorFactory struct{}
 
+func (f *ZhipuInterceptorFactory) Name() string {
+	return "zhipu"
+}
+
 func (f *ZhipuInterceptorFactory) ShouldIntercept(backendURL string) bool {
 	return strings.Contains(backendURL, "open.bigmodel.cn") || strings.Contains(backendURL, "api.z.ai")
 }
@@ -24,8 +35,44 @@ func (f *ZhipuInterceptorFactory) Create() Interceptor {
 	return &ZhipuInterceptor{}
 }
 
+type zhipuState int
+
+const (
+	zhipuText zhipuState = iota
+	zhipuName
+	zhipuArgs
+	zhipuKey
+	zhipuValueStart
+	zhipuValue
+)
+
 type ZhipuInterceptor struct {
 	buffer string
+	tools  map[string]any
+	state  zhipuState
+	calls  int
+
+	open      bool
+	index     int
+	name      string
+	schema    any
+	arguments strings.Builder
+	argCount  int
+
+	key          string
+	stringValue  bool
+	valueStarted bool
+	value        string
+
+	text    strings.Builder
+	emitted []OpenAIToolCall
+}
+
+func (z *ZhipuInterceptor) OnRequest(req *OpenAIRequest) {
+	z.tools = make(map[string]any)
+	for _, tool := range req.Tools {
+		z.tools[tool.Function.Name] = tool.Function.Parameters
+	}
 }
 
 func (z *ZhipuInterceptor) OnMessage(msg *AnthropicMessage) {
@@ -70,74 +117,269 @@ func (z *ZhipuInterceptor) OnDeltaStart(delta *OpenAIDelta) {
 	}
 
 	z.buffer += delta.ReasoningContent
+	for z.step() {
+	}
+
+	delta.ReasoningContent = z.text.String()
+	delta.ToolCalls = append(delta.ToolCalls, z.emitted...)
+	z.text.Reset()
+	z.emitted = nil
+}
 
-	for {
-		match := toolCallPattern.FindStringSubmatchIndex(z.buffer)
-		if match == nil {
-			break
+func (z *ZhipuInterceptor) OnStreamEnd(delta *OpenAIDelta) {
+	switch z.state {
+	case zhipuText:
+		z.text.WriteString(z.buffer)
+	case zhipuValue:
+		z.appendValue(z.buffer)
+		z.endValue()
+		z.closeCall()
+	case zhipuArgs, zhipuKey, zhipuValueStart:
+		z.closeCall()
+	}
+	z.buffer = ""
+	z.state = zhipuText
+
+	delta.ReasoningContent = z.text.String()
+	delta.ToolCalls = z.emitted
+	z.text.Reset()
+	z.emitted = nil
+}
+
+func (z *ZhipuInterceptor) step() bool {
+	switch z.state {
+	case zhipuText:
+		i := strings.Index(z.buffer, toolCallStart)
+		if i < 0 {
+			n := safePrefixLen(z.buffer, toolCallStart)
+			z.text.WriteString(z.buffer[:n])
+			z.buffer = z.buffer[n:]
+			return false
+		}
+		z.text.WriteString(z.buffer[:i])
+		z.buffer = z.buffer[i+len(toolCallStart):]
+		z.state = zhipuName
+		return true
+
+	case zhipuName:
+		trimmed := strings.TrimLeft(z.buffer, " \t\r\n")
+		i := strings.IndexAny(trimmed, "\n<")
+		if i < 0 {
+			z.buffer = trimmed
+			return false
+		}
+		z.openCall(strings.TrimSpace(trimmed[:i]))
+		z.buffer = trimmed[i:]
+		z.state = zhipuArgs
+		return true
+
+	case zhipuArgs:
+		trimmed := strings.TrimLeft(z.buffer, " \t\r\n")
+		switch {
+		case strings.HasPrefix(trimmed, argKeyStart):
+			z.buffer = trimmed[len(argKeyStart):]
+			z.state = zhipuKey
+			return true
+		case strings.HasPrefix(trimmed, toolCallEnd):
+			z.buffer = trimmed[len(toolCallEnd):]
+			z.closeCall()
+			z.state = zhipuText
+			return true
+		case strings.HasPrefix(argKeyStart, trimmed) || strings.HasPrefix(toolCallEnd, trimmed):
+			z.buffer = trimmed
+			return false
 		}
+		i := strings.IndexByte(trimmed[1:], '<')
+		if i < 0 {
+			z.buffer = ""
+			return false
+		}
+		z.buffer = trimmed[i+1:]
+		return true
+
+	case zhipuKey:
+		i := strings.Index(z.buffer, argKeyEnd)
+		if i < 0 {
+			return false
+		}
+		z.key = strings.TrimSpace(z.buffer[:i])
+		z.buffer = z.buffer[i+len(argKeyEnd):]
+		z.state = zhipuValueStart
+		return true
 
-		tc := parseToolCall(z.buffer[match[2]:match[3]])
-		if tc != nil {
-			delta.ToolCalls = append(delta.ToolCalls, *tc)
-			addLog(fmt.Sprintf("[Zhipu] Parsed tool_call: %s(%s)", tc.Function.Name, tc.Function.Arguments))
+	case zhipuValueStart:
+		trimmed := strings.TrimLeft(z.buffer, " \t\r\n")
+		if strings.HasPrefix(trimmed, argValueStart) {
+			z.buffer = trimmed[len(argValueStart):]
+			z.startValue()
+			z.state = zhipuValue
+			return true
+		}
+		z.buffer = trimmed
+		if strings.HasPrefix(argValueStart, trimmed) {
+			return false
 		}
+		z.state = zhipuArgs
+		return true
 
-		z.buffer = z.buffer[match[1]:]
+	case zhipuValue:
+		i := strings.Index(z.buffer, argValueEnd)
+		if i < 0 {
+			n := safePrefixLen(z.buffer, argValueEnd)
+			z.appendValue(z.buffer[:n])
+			z.buffer = z.buffer[n:]
+			return false
+		}
+		z.appendValue(z.buffer[:i])
+		z.buffer = z.buffer[i+len(argValueEnd):]
+		z.endValue()
+		z.state = zhipuArgs
+		return true
 	}
+	return false
 }
 
-func parseToolCall(content string) *OpenAIToolCall {
-	lines := strings.SplitN(strings.TrimSpace(content), "\n", 2)
-	if len(lines) == 0 {
-		return nil
+func (z *ZhipuInterceptor) openCall(name string) {
+	z.open = name != ""
+	z.arguments.Reset()
+	z.argCount = 0
+	if !z.open {
+		return
 	}
 
-	toolName := strings.TrimSpace(lines[0])
-	if toolName == "" {
-		return nil
+	z.index = interceptedToolIndexBase + z.calls
+	z.calls++
+	z.name = name
+	z.schema = z.tools[name]
+	z.emitted = append(z.emitted, OpenAIToolCall{
+		Index:    z.index,
+		ID:       newToolCallID(),
+		Type:     "function",
+		Function: ToolCallFunction{Name: name},
+	})
+}
+
+func (z *ZhipuInterceptor) closeCall() {
+	if !z.open {
+		return
+	}
+	if z.argCount == 0 {
+		z.emit("{}")
+	} else {
+		z.emit("}")
 	}
+	z.open = false
+	addLog(fmt.Sprintf("[Zhipu] Parsed tool_call: %s(%s)", z.name, z.arguments.String()))
+}
+
+func (z *ZhipuInterceptor) startValue() {
+	z.stringValue = isStringArgument(z.schema, z.key)
+	z.valueStarted = false
+	z.value = ""
 
-	var argsContent string
-	if len(lines) > 1 {
-		argsContent = lines[1]
+	separator := ","
+	if z.argCount == 0 {
+		separator = "{"
 	}
+	z.argCount++
+	key, _ := json.Marshal(z.key)
+	if z.stringValue {
+		z.emit(separator + string(key) + `:"`)
+	} else {
+		z.emit(separator + string(key) + ":")
+	}
+}
 
-	args := parseArguments(argsContent)
+// Trailing whitespace is held back in z.value until more text follows it.
+func (z *ZhipuInterceptor) appendValue(text string) {
+	if !z.stringValue {
+		z.value += text
+		return
+	}
+	if !z.valueStarted {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return
+		}
+		z.valueStarted = true
+	}
 
-	return &OpenAIToolCall{
-		ID:   fmt.Sprintf("call_%d", time.Now().UnixNano()),
-		Type: "function",
-		Function: ToolCallFunction{
-			Name:      toolName,
-			Arguments: args,
-		},
+	pending := z.value + text
+	body := strings.TrimRight(pending, " \t\r\n")
+	z.value = pending[len(body):]
+	if body != "" {
+		escaped, _ := json.Marshal(body)
+		z.emit(string(escaped[1 : len(escaped)-1]))
 	}
 }
 
-func parseArguments(content string) string {
-	args := make(map[string]any)
+func (z *ZhipuInterceptor) endValue() {
+	if z.stringValue {
+		z.emit(`"`)
+		return
+	}
+	value, _ := json.Marshal(deserializeArgument(strings.TrimSpace(z.value)))
+	z.emit(string(value))
+}
 
-	matches := argPairPattern.FindAllStringSubmatch(content, -1)
+func (z *ZhipuInterceptor) emit(arguments string) {
+	if !z.open {
+		return
+	}
+	z.arguments.WriteString(arguments)
+	if n := len(z.emitted); n > 0 && z.emitted[n-1].Index == z.index {
+		z.emitted[n-1].Function.Arguments += arguments
+		return
+	}
+	z.emitted = append(z.emitted, OpenAIToolCall{
+		Index:    z.index,
+		Function: ToolCallFunction{Arguments: arguments},
+	})
+}
 
-	for _, match := range matches {
-		if len(match) < 3 {
-			continue
+func safePrefixLen(text, tag string) int {
+	for k := min(len(text), len(tag)-1); k > 0; k-- {
+		if strings.HasSuffix(text, tag[:k]) {
+			return len(text) - k
 		}
+	}
+	return len(text)
+}
 
-		key := strings.TrimSpace(match[1])
-		value := strings.TrimSpace(match[2])
-
-		var parsed any
-		if err := json.Unmarshal([]byte(value), &parsed); err == nil {
-			args[key] = parsed
-		} else {
-			args[key] = value
+func isStringArgument(schema any, key string) bool {
+	schemaMap, ok := schema.(map[string]any)
+	if !ok {
+		return false
+	}
+	properties, _ := schemaMap["properties"].(map[string]any)
+	property, _ := properties[key].(map[string]any)
+	switch t := property["type"].(type) {
+	case string:
+		return t == "string"
+	case []any:
+		for _, item := range t {
+			if item == "string" {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	result, _ := json.Marshal(args)
-	return string(result)
+func deserializeArgument(value string) any {
+	var parsed any
+	if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+		return parsed
+	}
+	switch value {
+	case "True":
+		return true
+	case "False":
+		return false
+	case "None":
+		return nil
+	}
+	return value
 }
 
 func init() {
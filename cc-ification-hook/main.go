@@ -17,35 +17,36 @@ import (
 )
 
 var (
-	backendURL            string
-	backendAPIKey         string
-	backendModel          string
-	diagnosticMode        bool
-	ultrathinkPrompt      string
-	anthropicURL          string
-	anthropicAPIKey       string
-	anthropicModel        string
-	multimodalURL         string
-	multimodalAPIType     string
-	multimodalAPIKey      string
-	multimodalModel       string
-	multimodalMaxRounds   int
-	multimodalMaxTokens   int
-	tokenScaleFactor      float64
-	serverPort            int
-	keepRounds            int
-	startupTime           time.Time
-	logs                  []string
-	logsMu                sync.Mutex
-	totalPromptTokens     int64
-	totalCompletionTokens int64
-	totalCachedTokens     int64
-	totalTokens           int64
-	statsMu               sync.RWMutex
-	lastFirstTokenLatency float64
-	lastTokenThroughput   float64
-	recentRequestMetrics  []RequestMetrics
-	metricsMu             sync.RWMutex
+	backendURL               string
+	backendAPIKey            string
+	backendModel             string
+	diagnosticMode           bool
+	ultrathinkPrompt         string
+	anthropicURL             string
+	anthropicAPIKey          string
+	anthropicModel           string
+	multimodalURL            string
+	multimodalAPIType        string
+	multimodalAPIKey         string
+	multimodalModel          string
+	multimodalMaxRounds      int
+	multimodalMaxTokens      int
+	tokenScaleFactor         float64
+	serverPort               int
+	keepRounds               int
+	startupTime              time.Time
+	logs                     []string
+	logsMu                   sync.Mutex
+	totalPromptTokens        int64
+	totalCompletionTokens    int64
+	totalCachedTokens        int64
+	totalCacheCreationTokens int64
+	totalTokens              int64
+	statsMu                  sync.RWMutex
+	lastFirstTokenLatency    float64
+	lastTokenThroughput      float64
+	recentRequestMetrics     []RequestMetrics
+	metricsMu                sync.RWMutex
 )
 
 func main() {
@@ -65,16 +66,26 @@ func main() {
 	flag.Float64Var(scaleFlag, "s", 1.0, "Token scale factor")
 	roundFlag := flag.Int("round", 0, "Keep recent N rounds uncompressed")
 	flag.IntVar(roundFlag, "r", 0, "Keep recent N rounds uncompressed")
+	cacheStepFlag := flag.Int("cache-step", 0, "Advance compression boundary every N tokens")
+	flag.IntVar(cacheStepFlag, "c", 0, "Advance compression boundary every N tokens")
+	budgetFlag := flag.Int("context-budget", 0, "Compress oldest history until request fits in N tokens")
+	flag.IntVar(budgetFlag, "b", 0, "Compress oldest history until request fits in N tokens")
 	flag.Parse()
 
 	diagnosticMode = *diagnostic
 	tokenScaleFactor = *scaleFlag
 	serverPort = *port
 	keepRounds = *roundFlag
+	compressStepTokens = *cacheStepFlag
+	contextBudget = *budgetFlag
 
 	loadUltrathinkPrompt()
 	loadAnthropicConfig()
 	loadMultimodalConfig()
+	loadRoutesConfig()
+	loadRetryConfig()
+	loadSummarizeConfig()
+	loadCompressConfig()
 
 	if *urlFlag != "" {
 		backendURL = strings.TrimRight(*urlFlag, "/")
@@ -93,7 +104,9 @@ func main() {
 		backendModel = getInput("Backend Model (optional, uses original if empty): ", false)
 	}
 
-	InitInterceptor()
+	initDefaultRoutes()
+	initBackendClient()
+	startHealthProbes()
 
 	fmt.Println()
 	fmt.Println("🚀 CC-ification Hook")
@@ -112,10 +125,30 @@ func main() {
 		fmt.Println("   📊 TokenCount: estimate")
 	}
 	if multimodalURL != "" {
-		fmt.Println("   👁️ Multimodal: enabled")
+		fmt.Printf("   👁️ Multimodal: %s\n", multimodalMode)
+	}
+	if summaryModel != nil {
+		fmt.Println("   📝 Summarize: enabled")
 	}
 	if keepRounds > 0 {
-		fmt.Printf("   📦 Compress: keep %d rounds\n", keepRounds)
+		fmt.Printf("   📦 Compress: keep %d rounds", keepRounds)
+		if compressStepTokens > 0 {
+			fmt.Printf(" (step %d tokens)", compressStepTokens)
+		}
+		fmt.Println()
+	}
+	if contextBudget > 0 {
+		fmt.Printf("   📦 Context budget: %d tokens\n", contextBudget)
+	}
+	if retryMaxAttempts > 1 {
+		fmt.Printf("   🔁 Retry: up to %d attempts\n", retryMaxAttempts)
+	}
+	for _, route := range routes {
+		fmt.Printf("   🔀 Route: %s -> %s", route.Match, route.URL)
+		if len(route.Backends) > 1 {
+			fmt.Printf(" (+%d failover)", len(route.Backends)-1)
+		}
+		fmt.Println()
 	}
 	fmt.Printf("\n   export ANTHROPIC_BASE_URL=http://localhost:%d\n", serverPort)
 	fmt.Println("\n   Press Ctrl+C to stop")
@@ -186,12 +219,18 @@ func loadMultimodalConfig() {
 		return
 	}
 	var config struct {
-		URL       string `json:"url"`
-		APIType   string `json:"api_type"`
-		APIKey    string `json:"api_key"`
-		Model     string `json:"model"`
-		MaxRounds int    `json:"max_rounds"`
-		MaxTokens int    `json:"max_tokens"`
+		URL          string `json:"url"`
+		APIType      string `json:"api_type"`
+		APIKey       string `json:"api_key"`
+		Model        string `json:"model"`
+		MaxRounds    int    `json:"max_rounds"`
+		MaxTokens    int    `json:"max_tokens"`
+		Mode         string `json:"mode"`
+		RemoteImages *bool  `json:"remote_images"`
+		MaxImageSide *int   `json:"max_image_side"`
+		MaxPixels    *int   `json:"max_image_pixels"`
+		JPEGQuality  *int   `json:"jpeg_quality"`
+		JPEGMinKB    *int   `json:"jpeg_min_kb"`
 	}
 	if err := json.Unmarshal(data, &config); err != nil {
 		return
@@ -212,6 +251,35 @@ func loadMultimodalConfig() {
 		if multimodalMaxTokens <= 0 {
 			multimodalMaxTokens = 4096
 		}
+		if config.RemoteImages != nil {
+			multimodalRemoteImages = *config.RemoteImages
+		}
+		if config.MaxImageSide != nil && *config.MaxImageSide >= 0 {
+			maxImageSide = *config.MaxImageSide
+		}
+		if config.MaxPixels != nil && *config.MaxPixels >= 0 {
+			maxImagePixels = *config.MaxPixels
+		}
+		if config.JPEGQuality != nil && *config.JPEGQuality >= 0 && *config.JPEGQuality <= 100 {
+			jpegQuality = *config.JPEGQuality
+		}
+		if config.JPEGMinKB != nil && *config.JPEGMinKB >= 0 {
+			jpegMinBytes = *config.JPEGMinKB << 10
+		}
+		switch config.Mode {
+		case "", "route":
+		case "caption":
+			multimodalMode = config.Mode
+			captionModel = &AuxModel{
+				URL:       multimodalURL,
+				APIType:   multimodalAPIType,
+				APIKey:    multimodalAPIKey,
+				Model:     multimodalModel,
+				MaxTokens: multimodalMaxTokens,
+			}
+		default:
+			fmt.Printf("[✗] Unknown multimodal mode %q\n", config.Mode)
+		}
 		fmt.Println("[✓] Loaded multimodal.json")
 	}
 }
@@ -223,15 +291,17 @@ func saveUsageStats() {
 	promptTokens := totalPromptTokens
 	completionTokens := totalCompletionTokens
 	cachedTokens := totalCachedTokens
+	cacheCreationTokens := totalCacheCreationTokens
 	totalTokenCount := totalTokens
 	statsMu.RUnlock()
 
-	usageRecord := fmt.Sprintf("%s -> %s | Prompt: %d, Completion: %d, Cached: %d, Total: %d\n",
+	usageRecord := fmt.Sprintf("%s -> %s | Prompt: %d, Completion: %d, Cached: %d, CacheWrite: %d, Total: %d\n",
 		startupTime.Format("2006-01-02 15:04:05"),
 		endTime.Format("2006-01-02 15:04:05"),
 		promptTokens,
 		completionTokens,
 		cachedTokens,
+		cacheCreationTokens,
 		totalTokenCount)
 
 	file, err := os.OpenFile("usage.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	maxPDFDecodedBytes = 64 << 20
+	maxPDFNesting      = 64
+)
+
+var (
+	pdfObjectPattern  = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRefPattern     = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+	pdfRefListPattern = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfSpacePattern   = regexp.MustCompile(`[ \t]+`)
+	pdfBlankPattern   = regexp.MustCompile(`\n{3,}`)
+)
+
+type pdfObject struct {
+	dict   string
+	stream []byte
+}
+
+type pdfCMap struct {
+	codeBytes int
+	chars     map[uint32]string
+}
+
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	cmaps   map[int]*pdfCMap
+	decoded int
+	err     error
+}
+
+func extractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return "", fmt.Errorf("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", fmt.Errorf("encrypted PDFs are not supported")
+	}
+	doc := &pdfDocument{cmaps: make(map[int]*pdfCMap)}
+	doc.parseObjects(data)
+
+	var pages []string
+	for _, page := range doc.pages() {
+		if text := doc.pageText(page.obj, page.resources); strings.TrimSpace(text) != "" {
+			pages = append(pages, text)
+		}
+	}
+	if doc.err != nil {
+		return "", doc.err
+	}
+	text := strings.Join(pages, "\n\n")
+	text = pdfSpacePattern.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = pdfBlankPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text), nil
+}
+
+func (doc *pdfDocument) parseObjects(data []byte) {
+	objects := make(map[int]*pdfObject)
+	doc.objects = objects
+	endObjs := pdfKeywordOffsets(data, "endobj")
+	matches := pdfObjectPattern.FindAllSubmatchIndex(data, -1)
+	for i, match := range matches {
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		body := data[match[1]:]
+		end := -1
+		if j := sort.SearchInts(endObjs, match[1]); j < len(endObjs) {
+			end = endObjs[j] - match[1]
+		}
+		head := body
+		if end >= 0 {
+			head = body[:end]
+		} else if i+1 < len(matches) {
+			head = body[:matches[i+1][0]-match[1]]
+		}
+		obj := &pdfObject{}
+		if streamStart := pdfStreamKeyword(head); streamStart >= 0 {
+			obj.dict = string(body[:streamStart])
+			dataStart := streamStart + len("stream")
+			if bytes.HasPrefix(body[dataStart:], []byte("\r")) {
+				dataStart++
+			}
+			if bytes.HasPrefix(body[dataStart:], []byte("\n")) {
+				dataStart++
+			}
+			stream := body[dataStart:]
+			if length, err := strconv.Atoi(pdfDictValue(obj.dict, "Length")); err == nil && length >= 0 && length <= len(stream) {
+				stream = stream[:length]
+			} else if dataStart <= len(head) {
+				stream = head[dataStart:]
+				if streamEnd := bytes.Index(stream, []byte("endstream")); streamEnd >= 0 {
+					stream = stream[:streamEnd]
+				}
+			}
+			obj.stream = stream
+		} else if end >= 0 {
+			obj.dict = string(body[:end])
+		} else {
+			continue
+		}
+		objects[num] = obj
+	}
+
+	for _, obj := range objects {
+		if pdfDictValue(obj.dict, "Type") == "/ObjStm" {
+			doc.parseObjectStream(obj)
+		}
+	}
+}
+
+func pdfKeywordOffsets(data []byte, keyword string) []int {
+	var offsets []int
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte(keyword))
+		if i < 0 {
+			return offsets
+		}
+		offsets = append(offsets, pos+i)
+		pos += i + len(keyword)
+	}
+}
+
+// pdfStreamKeyword finds the stream keyword that directly follows the object's dictionary.
+func pdfStreamKeyword(head []byte) int {
+	for pos := 0; ; {
+		i := bytes.Index(head[pos:], []byte("stream"))
+		if i < 0 {
+			return -1
+		}
+		i += pos
+		after := i + len("stream")
+		if bytes.HasSuffix(bytes.TrimRight(head[:i], " \t\r\n\f\x00"), []byte(">>")) && (after == len(head) || isPDFSpace(head[after])) {
+			return i
+		}
+		pos = after
+	}
+}
+
+func (doc *pdfDocument) parseObjectStream(stream *pdfObject) {
+	data := doc.decodeStream(stream)
+	count, _ := strconv.Atoi(pdfDictValue(stream.dict, "N"))
+	first, _ := strconv.Atoi(pdfDictValue(stream.dict, "First"))
+	if data == nil || first <= 0 || first > len(data) {
+		return
+	}
+	header := strings.Fields(string(data[:first]))
+	for i := 0; i < count && 2*i+1 < len(header); i++ {
+		num, err1 := strconv.Atoi(header[2*i])
+		offset, err2 := strconv.Atoi(header[2*i+1])
+		if err1 != nil || err2 != nil || offset < 0 || offset > len(data)-first {
+			continue
+		}
+		end := len(data)
+		if 2*i+3 < len(header) {
+			if next, err := strconv.Atoi(header[2*i+3]); err == nil && next >= offset && next <= len(data)-first {
+				end = first + next
+			}
+		}
+		if first+offset > end {
+			continue
+		}
+		if _, ok := doc.objects[num]; !ok {
+			doc.objects[num] = &pdfObject{dict: string(data[first+offset : end])}
+		}
+	}
+}
+
+func (doc *pdfDocument) decodeStream(obj *pdfObject) []byte {
+	if doc.err != nil {
+		return nil
+	}
+	filter := pdfDictValue(obj.dict, "Filter")
+	switch {
+	case filter == "":
+		return obj.stream
+	case strings.Contains(filter, "/FlateDecode") && !strings.Contains(strings.Replace(filter, "/FlateDecode", "", 1), "/"):
+		reader, err := zlib.NewReader(bytes.NewReader(obj.stream))
+		if err != nil {
+			return nil
+		}
+		data, _ := io.ReadAll(io.LimitReader(reader, int64(maxPDFDecodedBytes-doc.decoded)+1))
+		doc.decoded += len(data)
+		if doc.decoded > maxPDFDecodedBytes {
+			doc.err = fmt.Errorf("streams decompress to more than %d MB", maxPDFDecodedBytes>>20)
+			return nil
+		}
+		return data
+	}
+	return nil
+}
+
+type pdfPage struct {
+	obj       *pdfObject
+	resources string
+}
+
+func (doc *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+	visited := make(map[int]bool)
+	var walk func(num int, resources string)
+	walk = func(num int, resources string) {
+		obj := doc.objects[num]
+		if obj == nil || visited[num] {
+			return
+		}
+		visited[num] = true
+		if value := pdfDictValue(obj.dict, "Resources"); value != "" {
+			resources = value
+		}
+		if kids := pdfDictValue(obj.dict, "Kids"); kids != "" {
+			for _, ref := range pdfRefListPattern.FindAllStringSubmatch(kids, -1) {
+				kid, _ := strconv.Atoi(ref[1])
+				walk(kid, resources)
+			}
+			return
+		}
+		if pdfDictValue(obj.dict, "Type") == "/Page" {
+			pages = append(pages, pdfPage{obj: obj, resources: resources})
+		}
+	}
+
+	for _, num := range doc.sortedObjectNumbers() {
+		if pdfDictValue(doc.objects[num].dict, "Type") == "/Catalog" {
+			if root, ok := pdfRef(pdfDictValue(doc.objects[num].dict, "Pages")); ok {
+				walk(root, "")
+			}
+			break
+		}
+	}
+	if len(pages) == 0 {
+		for _, num := range doc.sortedObjectNumbers() {
+			if pdfDictValue(doc.objects[num].dict, "Type") == "/Page" {
+				pages = append(pages, pdfPage{obj: doc.objects[num], resources: pdfDictValue(doc.objects[num].dict, "Resources")})
+			}
+		}
+	}
+	return pages
+}
+
+func (doc *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+func (doc *pdfDocument) resolve(value string) string {
+	if num, ok := pdfRef(value); ok {
+		if obj := doc.objects[num]; obj != nil {
+			return strings.TrimSpace(obj.dict)
+		}
+	}
+	return value
+}
+
+func (doc *pdfDocument) pageText(page *pdfObject, resources string) string {
+	fonts := make(map[string]*pdfCMap)
+	fontDict := doc.resolve(pdfDictValue(doc.resolve(resources), "Font"))
+	for name, ref := range pdfDictEntries(fontDict) {
+		if num, ok := pdfRef(ref); ok {
+			fonts[name] = doc.fontCMap(num)
+		}
+	}
+
+	var content []byte
+	contents := pdfDictValue(page.dict, "Contents")
+	if num, ok := pdfRef(contents); ok && doc.objects[num] != nil && doc.objects[num].stream == nil {
+		contents = doc.objects[num].dict
+	}
+	for _, ref := range pdfRefListPattern.FindAllStringSubmatch(contents, -1) {
+		num, _ := strconv.Atoi(ref[1])
+		if obj := doc.objects[num]; obj != nil {
+			content = append(content, doc.decodeStream(obj)...)
+			content = append(content, '\n')
+		}
+	}
+	text, err := interpretPDFContent(content, fonts)
+	if err != nil && doc.err == nil {
+		doc.err = err
+	}
+	return text
+}
+
+func (doc *pdfDocument) fontCMap(num int) *pdfCMap {
+	if cmap, ok := doc.cmaps[num]; ok {
+		return cmap
+	}
+	var cmap *pdfCMap
+	if font := doc.objects[num]; font != nil {
+		if ref, ok := pdfRef(pdfDictValue(font.dict, "ToUnicode")); ok && doc.objects[ref] != nil {
+			var err error
+			if cmap, err = parsePDFCMap(doc.decodeStream(doc.objects[ref])); err != nil && doc.err == nil {
+				doc.err = err
+			}
+		}
+		if cmap == nil && pdfDictValue(font.dict, "Subtype") == "/Type0" {
+			cmap = &pdfCMap{codeBytes: 2, chars: map[uint32]string{}}
+		}
+	}
+	doc.cmaps[num] = cmap
+	return cmap
+}
+
+func parsePDFCMap(data []byte) (*pdfCMap, error) {
+	if data == nil {
+		return nil, nil
+	}
+	cmap := &pdfCMap{codeBytes: 1, chars: make(map[uint32]string)}
+	lexer := &pdfLexer{data: data}
+	var operands []pdfToken
+	section := ""
+	for {
+		token := lexer.next()
+		if token.kind == pdfEOF {
+			break
+		}
+		if token.kind != pdfOperator {
+			operands = append(operands, token)
+			continue
+		}
+		switch token.value {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = token.value
+		case "endcodespacerange":
+			if len(operands) > 0 && operands[0].kind == pdfString && len(operands[0].value) > 0 {
+				cmap.codeBytes = len(operands[0].value)
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				cmap.chars[pdfCode(operands[i].value)] = decodeUTF16BE(operands[i+1].value)
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, hi := pdfCode(operands[i].value), pdfCode(operands[i+1].value)
+				if hi < lo || hi-lo > 0xFFFF {
+					continue
+				}
+				dst := operands[i+2]
+				for code := lo; code <= hi; code++ {
+					if dst.kind == pdfArray {
+						if int(code-lo) < len(dst.items) {
+							cmap.chars[code] = decodeUTF16BE(dst.items[code-lo].value)
+						}
+						continue
+					}
+					base := []rune(decodeUTF16BE(dst.value))
+					if len(base) > 0 {
+						base[len(base)-1] += rune(code - lo)
+					}
+					cmap.chars[code] = string(base)
+				}
+			}
+			section = ""
+		}
+		if section == "" || token.value == section {
+			operands = operands[:0]
+		}
+	}
+	return cmap, lexer.err
+}
+
+func interpretPDFContent(content []byte, fonts map[string]*pdfCMap) (string, error) {
+	var sb strings.Builder
+	lexer := &pdfLexer{data: content}
+	var operands []pdfToken
+	var font *pdfCMap
+	lastY := ""
+	newline := func() {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+	}
+	for {
+		token := lexer.next()
+		if token.kind == pdfEOF {
+			break
+		}
+		if token.kind != pdfOperator {
+			operands = append(operands, token)
+			continue
+		}
+		switch token.value {
+		case "Tf":
+			if len(operands) >= 2 {
+				font = fonts[operands[len(operands)-2].value]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				sb.WriteString(decodePDFString(operands[len(operands)-1].value, font))
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				sb.WriteString(decodePDFString(operands[len(operands)-1].value, font))
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, item := range operands[len(operands)-1].items {
+					if item.kind == pdfString {
+						sb.WriteString(decodePDFString(item.value, font))
+					} else if n, err := strconv.ParseFloat(item.value, 64); err == nil && n < -200 {
+						sb.WriteByte(' ')
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) < 2 {
+				break
+			}
+			if ty, err := strconv.ParseFloat(operands[len(operands)-1].value, 64); err == nil && ty != 0 {
+				newline()
+			} else {
+				sb.WriteByte(' ')
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				if y := operands[len(operands)-1].value; y != lastY {
+					lastY = y
+					newline()
+				} else {
+					sb.WriteByte(' ')
+				}
+			}
+		case "ET":
+			sb.WriteByte(' ')
+		}
+		operands = operands[:0]
+	}
+	return sb.String(), lexer.err
+}
+
+func decodePDFString(value string, cmap *pdfCMap) string {
+	if cmap == nil {
+		runes := make([]rune, 0, len(value))
+		for i := 0; i < len(value); i++ {
+			if c := value[i]; c >= 0x20 || c == '\t' || c == '\n' {
+				runes = append(runes, rune(c))
+			}
+		}
+		return string(runes)
+	}
+	var sb strings.Builder
+	for i := 0; i+cmap.codeBytes <= len(value); i += cmap.codeBytes {
+		sb.WriteString(cmap.chars[pdfCode(value[i:i+cmap.codeBytes])])
+	}
+	return sb.String()
+}
+
+func pdfCode(value string) uint32 {
+	var code uint32
+	for i := 0; i < len(value); i++ {
+		code = code<<8 | uint32(value[i])
+	}
+	return code
+}
+
+func decodeUTF16BE(value string) string {
+	units := make([]uint16, 0, len(value)/2)
+	for i := 0; i+1 < len(value); i += 2 {
+		units = append(units, uint16(value[i])<<8|uint16(value[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func pdfRef(value string) (int, bool) {
+	match := pdfRefPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, false
+	}
+	num, err := strconv.Atoi(match[1])
+	return num, err == nil
+}
+
+func pdfDictValue(dict, key string) string {
+	return pdfDictEntries(dict)[key]
+}
+
+func pdfDictEntries(dict string) map[string]string {
+	entries := make(map[string]string)
+	dict = strings.TrimSpace(dict)
+	start := strings.Index(dict, "<<")
+	if start < 0 {
+		return entries
+	}
+	data := dict[start+2:]
+	pos := 0
+	for pos < len(data) {
+		for pos < len(data) && isPDFSpace(data[pos]) {
+			pos++
+		}
+		if pos >= len(data) || data[pos] != '/' {
+			break
+		}
+		keyEnd := pos + 1
+		for keyEnd < len(data) && !isPDFSpace(data[keyEnd]) && !isPDFDelimiter(data[keyEnd]) {
+			keyEnd++
+		}
+		key := data[pos+1 : keyEnd]
+		valueStart := keyEnd
+		for valueStart < len(data) && isPDFSpace(data[valueStart]) {
+			valueStart++
+		}
+		valueEnd := skipPDFValue(data, valueStart)
+		if ref := pdfRefPattern.FindStringIndex(data[valueStart:]); ref != nil && ref[0] == 0 {
+			valueEnd = valueStart + ref[1]
+		}
+		entries[key] = strings.TrimSpace(data[valueStart:valueEnd])
+		pos = valueEnd
+	}
+	return entries
+}
+
+func skipPDFValue(data string, pos int) int {
+	if pos >= len(data) {
+		return pos
+	}
+	switch {
+	case strings.HasPrefix(data[pos:], "<<"):
+		depth := 0
+		for i := pos; i < len(data)-1; i++ {
+			switch {
+			case data[i] == '(':
+				i = skipPDFLiteral(data, i) - 1
+			case data[i:i+2] == "<<":
+				depth++
+				i++
+			case data[i:i+2] == ">>":
+				depth--
+				i++
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(data)
+	case data[pos] == '[':
+		depth := 0
+		for i := pos; i < len(data); i++ {
+			switch data[i] {
+			case '(':
+				i = skipPDFLiteral(data, i) - 1
+			case '[':
+				depth++
+			case ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(data)
+	case data[pos] == '(':
+		return skipPDFLiteral(data, pos)
+	case data[pos] == '<':
+		if end := strings.IndexByte(data[pos:], '>'); end >= 0 {
+			return pos + end + 1
+		}
+		return len(data)
+	}
+	end := pos + 1
+	for end < len(data) && !isPDFSpace(data[end]) && !isPDFDelimiter(data[end]) {
+		end++
+	}
+	return end
+}
+
+func skipPDFLiteral(data string, pos int) int {
+	depth := 0
+	for i := pos; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(data)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+const (
+	pdfEOF = iota
+	pdfNumber
+	pdfName
+	pdfString
+	pdfArray
+	pdfDict
+	pdfOperator
+)
+
+type pdfToken struct {
+	kind  int
+	value string
+	items []pdfToken
+}
+
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+	err   error
+}
+
+func (l *pdfLexer) enter() bool {
+	if l.depth >= maxPDFNesting {
+		l.err = fmt.Errorf("arrays or dictionaries nested deeper than %d levels", maxPDFNesting)
+		l.pos = len(l.data)
+		return false
+	}
+	l.depth++
+	return true
+}
+
+func (l *pdfLexer) leave() {
+	l.depth--
+}
+
+func (l *pdfLexer) next() pdfToken {
+	for {
+		for l.pos < len(l.data) && isPDFSpace(l.data[l.pos]) {
+			l.pos++
+		}
+		if l.pos >= len(l.data) {
+			return pdfToken{kind: pdfEOF}
+		}
+		if l.data[l.pos] != '%' {
+			break
+		}
+		for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+			l.pos++
+		}
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return pdfToken{kind: pdfString, value: l.literal()}
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		if !l.enter() {
+			return pdfToken{kind: pdfEOF}
+		}
+		defer l.leave()
+		for {
+			token := l.next()
+			if token.kind == pdfEOF || (token.kind == pdfOperator && token.value == ">>") {
+				return pdfToken{kind: pdfDict}
+			}
+		}
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfToken{kind: pdfOperator, value: ">>"}
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			end = len(l.data) - l.pos
+		}
+		digits := strings.Map(func(r rune) rune {
+			if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return r
+			}
+			return -1
+		}, string(l.data[l.pos+1:l.pos+end]))
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		l.pos += end + 1
+		decoded, _ := hex.DecodeString(digits)
+		return pdfToken{kind: pdfString, value: string(decoded)}
+	case c == '[':
+		l.pos++
+		if !l.enter() {
+			return pdfToken{kind: pdfEOF}
+		}
+		defer l.leave()
+		var items []pdfToken
+		for {
+			token := l.next()
+			if token.kind == pdfEOF || (token.kind == pdfOperator && token.value == "]") {
+				return pdfToken{kind: pdfArray, items: items}
+			}
+			items = append(items, token)
+		}
+	case c == ']':
+		l.pos++
+		return pdfToken{kind: pdfOperator, value: "]"}
+	case c == '/':
+		start := l.pos + 1
+		l.pos++
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfToken{kind: pdfName, value: string(l.data[start:l.pos])}
+	}
+
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if _, err := strconv.ParseFloat(word, 64); err == nil {
+		return pdfToken{kind: pdfNumber, value: word}
+	}
+	if word == "ID" {
+		l.skipInlineImage()
+	}
+	return pdfToken{kind: pdfOperator, value: word}
+}
+
+func (l *pdfLexer) literal() string {
+	var sb strings.Builder
+	depth := 0
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return sb.String()
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return sb.String()
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(value)
+				}
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func (l *pdfLexer) skipInlineImage() {
+	end := bytes.Index(l.data[l.pos:], []byte("EI"))
+	for end >= 0 {
+		at := l.pos + end
+		if at > 0 && isPDFSpace(l.data[at-1]) && (at+2 >= len(l.data) || isPDFSpace(l.data[at+2])) {
+			l.pos = at + 2
+			return
+		}
+		next := bytes.Index(l.data[at+2:], []byte("EI"))
+		if next < 0 {
+			break
+		}
+		end = at + 2 + next - l.pos
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func buildPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func pdfStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func pdfWithContent(content string) []byte {
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStream("", []byte(content)),
+	)
+}
+
+func pdfWithObjectStream(header string, body string) []byte {
+	data := header + body
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [10 0 R] /Count 1 >>",
+		pdfStream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d", len(header)), []byte(data)),
+		pdfStream("", []byte("BT (Hi) Tj ET")),
+	)
+}
+
+func TestExtractPDFText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"plain", pdfWithContent("BT /F1 12 Tf 72 700 Td (Hello) Tj 0 -14 Td (world) Tj ET"), "Hello\nworld"},
+		{"flate", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+			pdfStream("/Filter /FlateDecode", deflate([]byte("BT (Hi) Tj ET"))),
+		), "Hi"},
+		{"stream name in dictionary", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /stream true /Contents 4 0 R >>",
+			pdfStream("", []byte("BT (Hi) Tj ET")),
+		), "Hi"},
+		{"object stream", pdfWithObjectStream("10 0 11 33 ", "<< /Type /Page /Contents 4 0 R >><<>>"), "Hi"},
+		{"Td without operands", pdfWithContent("BT Td (hi) Tj ET"), "hi"},
+		{"TD with one operand", pdfWithContent("BT 5 TD (hi) Tj ET"), "hi"},
+		{"Tj without operands", pdfWithContent("BT Tj TJ ' \" Tf Tm ET"), ""},
+		{"unterminated string", pdfWithContent("BT (abc"), ""},
+		{"unterminated array", pdfWithContent("BT [(a) (b"), ""},
+		{"unterminated hex", pdfWithContent("BT <41424"), ""},
+	}
+
+	for _, tt := range tests {
+		got, err := extractPDFText(tt.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a PDF", []byte("hello")},
+		{"header only", []byte("%PDF-1.4")},
+		{"truncated object", []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R")},
+		{"truncated stream", []byte("%PDF-1.4\n1 0 obj\n<< /Length 500 >>\nstream\nBT (hi")},
+		{"truncated xref", append(pdfWithContent("BT (hi) Tj ET"), "xref\n0 6\n0000000000 65535 f \n00000"...)},
+		{"negative length", []byte("%PDF-1.4\n1 0 obj\n<< /Length -5 >>\nstream\nabc\nendstream\nendobj\n")},
+		{"cyclic page tree", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [2 0 R 3 0 R] >>",
+			"<< /Type /Pages /Kids [2 0 R] >>",
+		)},
+		{"negative ObjStm offset", pdfWithObjectStream("10 -30 11 2 ", "<< /Type /Page /Contents 4 0 R >>")},
+		{"ObjStm offset past end", pdfWithObjectStream("10 9999 11 3 ", "<< /Type /Page /Contents 4 0 R >>")},
+		{"ObjStm offsets out of order", pdfWithObjectStream("10 10 11 2 ", "<< /Type /Page /Contents 4 0 R >>")},
+		{"ObjStm First past end", buildPDF(pdfStream("/Type /ObjStm /N 1 /First 9999", []byte("4 0 <<>>")))},
+		{"ObjStm huge count", buildPDF(pdfStream("/Type /ObjStm /N 99999999 /First 4", []byte("4 0 <<>>")))},
+		{"bad flate data", buildPDF(pdfStream("/Filter /FlateDecode", []byte("not zlib")))},
+		{"huge bfrange", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] >>",
+			"<< /Type /Page /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+			pdfStream("", []byte("BT /F1 1 Tf <0001> Tj ET")),
+			"<< /Type /Font /ToUnicode 6 0 R >>",
+			pdfStream("", []byte("1 begincodespacerange <0000> <FFFF> endcodespacerange 1 beginbfrange <0000> <FFFFFFFF> <0041> endbfrange")),
+		)},
+		{"inline image without EI", pdfWithContent("BT BI /W 1 ID \x00\x01\x02")},
+		{"many objects without endobj", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("1 0 obj << /Type /Page >>\n"), 50000)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractPDFText(tt.data)
+		})
+	}
+}
+
+func TestExtractPDFTextRejectsZlibBomb(t *testing.T) {
+	bomb := deflate(bytes.Repeat([]byte("A"), maxPDFDecodedBytes+1))
+	data := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] >>",
+		"<< /Type /Page /Contents 4 0 R >>",
+		pdfStream("/Filter /FlateDecode", bomb),
+	)
+	if _, err := extractPDFText(data); err == nil || !strings.Contains(err.Error(), "decompress") {
+		t.Errorf("got err %v, want a decompression limit error", err)
+	}
+}
+
+func TestExtractPDFTextRejectsDeepNesting(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"arrays", pdfWithContent("BT " + strings.Repeat("[", 1<<20) + " ET")},
+		{"dictionaries", pdfWithContent("BT " + strings.Repeat("<<", 1<<20) + " ET")},
+		{"flate", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			pdfStream("/Filter /FlateDecode", deflate(bytes.Repeat([]byte("["), 1<<22))),
+		)},
+		{"cmap", buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] >>",
+			"<< /Type /Page /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+			pdfStream("", []byte("BT /F1 1 Tf (hi) Tj ET")),
+			"<< /Type /Font /ToUnicode 6 0 R >>",
+			pdfStream("", bytes.Repeat([]byte("["), 1<<20)),
+		)},
+	}
+
+	for _, tt := range tests {
+		if _, err := extractPDFText(tt.data); err == nil || !strings.Contains(err.Error(), "nested") {
+			t.Errorf("%s: got err %v, want a nesting limit error", tt.name, err)
+		}
+	}
+	if _, err := extractPDFText(pdfWithContent("BT " + strings.Repeat("[", maxPDFNesting) + "(hi) Tj ET")); err != nil {
+		t.Errorf("nesting at the limit: unexpected error: %v", err)
+	}
+}
+
+func FuzzExtractPDFText(f *testing.F) {
+	f.Add(pdfWithContent("BT /F1 12 Tf 72 700 Td (Hello) Tj ET"))
+	f.Add(pdfWithContent("BT Td (hi) Tj ET"))
+	f.Add(pdfWithObjectStream("10 -30 11 2 ", "<< /Type /Page /Contents 4 0 R >>"))
+	f.Add(append(pdfWithContent("BT (hi) Tj ET"), "xref\n0 6\n00000"...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		extractPDFText(data)
+	})
+}
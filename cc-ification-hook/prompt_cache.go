@@ -0,0 +1,81 @@
+package main
+
+import "strings"
+
+func supportsPromptCache(route *Route, backendURL string) bool {
+	if route == nil {
+		return false
+	}
+	if route.CacheControl != nil {
+		return *route.CacheControl
+	}
+	return strings.Contains(backendURL, "dashscope") || strings.Contains(backendURL, "openrouter.ai")
+}
+
+func (ctx *ConvertContext) cacheControl(block map[string]any) any {
+	if !ctx.PromptCache {
+		return nil
+	}
+	return block["cache_control"]
+}
+
+func (ctx *ConvertContext) toolResultCacheControl(block map[string]any) any {
+	if marker := ctx.cacheControl(block); marker != nil {
+		return marker
+	}
+	items, ok := block["content"].([]any)
+	if !ok || len(items) == 0 {
+		return nil
+	}
+	if last, ok := items[len(items)-1].(map[string]any); ok {
+		return ctx.cacheControl(last)
+	}
+	return nil
+}
+
+func withCacheControl(content any, marker any) any {
+	if marker == nil {
+		return content
+	}
+	switch v := content.(type) {
+	case string:
+		return []OpenAIContentPart{{Type: "text", Text: v, CacheControl: marker}}
+	case []OpenAIContentPart:
+		if len(v) > 0 {
+			v[len(v)-1].CacheControl = marker
+		}
+		return v
+	}
+	return content
+}
+
+func convertSystemContent(system any, ctx *ConvertContext) any {
+	blocks, ok := system.([]any)
+	if !ok || !ctx.PromptCache {
+		return extractSystemContent(system)
+	}
+
+	var parts []OpenAIContentPart
+	hasMarker := false
+	for _, item := range blocks {
+		switch t := item.(type) {
+		case string:
+			parts = append(parts, OpenAIContentPart{Type: "text", Text: t})
+		case map[string]any:
+			text, ok := t["text"].(string)
+			if !ok {
+				continue
+			}
+			marker := ctx.cacheControl(t)
+			if marker != nil {
+				hasMarker = true
+			}
+			parts = append(parts, OpenAIContentPart{Type: "text", Text: text, CacheControl: marker})
+		}
+	}
+
+	if !hasMarker {
+		return extractSystemContent(system)
+	}
+	return contentPartsToAny(parts)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	aggressiveResultChars = 8000
+	aggressiveHeadChars   = 5000
+)
+
+var contextLengthPatterns = []string{
+	"context length",
+	"context_length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"input is too long",
+	"reduce the length",
+}
+
+var inputLengthPatterns = []string{
+	"too many tokens",
+	"exceeds the maximum",
+}
+
+func isContextLengthError(status int, body []byte) bool {
+	if status != http.StatusBadRequest && status != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	code, _, message := parseUpstreamError(body)
+	switch code {
+	case "context_length_exceeded", "string_above_max_length", "1261":
+		return true
+	}
+	lower := strings.ToLower(message)
+	if lower == "" {
+		lower = strings.ToLower(string(body))
+	}
+	for _, pattern := range contextLengthPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	if strings.Contains(lower, "max_tokens") || strings.Contains(lower, "max_completion_tokens") {
+		return false
+	}
+	for _, pattern := range inputLengthPatterns {
+		if strings.Contains(lower, pattern) && (strings.Contains(lower, "prompt") || strings.Contains(lower, "input") || strings.Contains(lower, "message")) {
+			return true
+		}
+	}
+	return false
+}
+
+func sendWithContextRecovery(r *http.Request, req *AnthropicRequest, route *Route, servingRoute *Route, result *ConvertResult) (*http.Response, *ConvertResult, error) {
+	resp, backend, result, err := sendWithRetry(r, servingRoute, result)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, result, err
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if !isContextLengthError(resp.StatusCode, body) {
+		return resp, result, nil
+	}
+
+	aggressive, err := convertRequest(req, route, backend.URL, true)
+	if err != nil || aggressive.IsAnthropic {
+		return resp, result, nil
+	}
+
+	addLog(fmt.Sprintf("[Recover] Context length exceeded, retrying with aggressive compression (~%d -> ~%d tokens)",
+		estimateOpenAIRequestTokens(result.OpenAIRequest), estimateOpenAIRequestTokens(aggressive.OpenAIRequest)))
+
+	retryResp, _, aggressive, err := sendWithRetry(r, servingRoute, aggressive)
+	if err != nil {
+		addLog(fmt.Sprintf("[Recover] Retry failed: %v", err))
+		return resp, result, nil
+	}
+	if retryResp.StatusCode < 400 {
+		addLog("[Recover] Aggressive compression succeeded")
+	}
+	return retryResp, aggressive, nil
+}
+
+func sendAnthropicWithContextRecovery(req *AnthropicRequest, route *Route, result *ConvertResult) (*http.Response, error) {
+	resp, err := sendAnthropicRequest(result.AnthropicRequest)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if !isContextLengthError(resp.StatusCode, body) {
+		return resp, nil
+	}
+
+	aggressive, err := convertRequest(req, route, "", true)
+	if err != nil || !aggressive.IsAnthropic {
+		return resp, nil
+	}
+
+	addLog("[Recover] Context length exceeded, retrying multimodal request with aggressive compression")
+
+	retryResp, err := sendAnthropicRequest(aggressive.AnthropicRequest)
+	if err != nil {
+		addLog(fmt.Sprintf("[Recover] Retry failed: %v", err))
+		return resp, nil
+	}
+	if retryResp.StatusCode < 400 {
+		addLog("[Recover] Aggressive compression succeeded")
+	}
+	return retryResp, nil
+}
+
+func truncateLongResults(messages []AnthropicMessage, start int, ctx *ConvertContext) []AnthropicMessage {
+	result := make([]AnthropicMessage, len(messages))
+	copy(result, messages)
+	for i := start; i < len(result); i++ {
+		content, ok := result[i].Content.([]any)
+		if !ok || result[i].Role != "user" {
+			continue
+		}
+		var rewritten []any
+		changed := false
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if ok && blockMap["type"] == "tool_result" {
+				text := toolResultText(blockMap["content"])
+				if len(text) > aggressiveResultChars {
+					ctx.Stats.Truncated++
+					changed = true
+					rewritten = append(rewritten, copyBlock(blockMap, "content", truncateChars(text)))
+					continue
+				}
+			}
+			rewritten = append(rewritten, block)
+		}
+		if changed {
+			result[i].Content = rewritten
+		}
+	}
+	return result
+}
+
+func truncateChars(text string) string {
+	head := aggressiveHeadChars
+	for head > 0 && !utf8.RuneStart(text[head]) {
+		head--
+	}
+	tail := len(text) - (aggressiveResultChars - aggressiveHeadChars)
+	for tail < len(text) && !utf8.RuneStart(text[tail]) {
+		tail++
+	}
+	return text[:head] + fmt.Sprintf("\n... (%d characters omitted) ...\n", tail-head) + text[tail:]
+}
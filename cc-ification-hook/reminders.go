@@ -0,0 +1,125 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultReminderChars = 200
+
+var (
+	systemReminderPattern = regexp.MustCompile(`(?s)<system-reminder>(.*?)</system-reminder>\n?`)
+	reminderMode          = "keep"
+	reminderChars         = defaultReminderChars
+)
+
+func rewriteReminders(messages []AnthropicMessage, start, roundStart int, counter TokenCounter, ctx *ConvertContext) []AnthropicMessage {
+	if reminderMode == "keep" {
+		return messages
+	}
+
+	var result []AnthropicMessage
+	for i := start; i < roundStart && i < len(messages); i++ {
+		msg := messages[i]
+		if i == 0 || msg.Role != "user" {
+			continue
+		}
+		rewritten, changed := rewriteReminderContent(msg.Content, counter, ctx)
+		if !changed {
+			continue
+		}
+		if result == nil {
+			result = make([]AnthropicMessage, len(messages))
+			copy(result, messages)
+		}
+		result[i].Content = rewritten
+	}
+	if result == nil {
+		return messages
+	}
+	return result
+}
+
+func rewriteReminderContent(content any, counter TokenCounter, ctx *ConvertContext) (any, bool) {
+	switch v := content.(type) {
+	case string:
+		text := rewriteReminderText(v, counter, ctx)
+		return text, text != v
+	case []any:
+		var items []any
+		changed := false
+		for _, item := range v {
+			itemMap, ok := item.(map[string]any)
+			if !ok {
+				items = append(items, item)
+				continue
+			}
+			switch itemMap["type"] {
+			case "text":
+				text, _ := itemMap["text"].(string)
+				rewrittenText := rewriteReminderText(text, counter, ctx)
+				if rewrittenText == text {
+					break
+				}
+				changed = true
+				if rewrittenText == "" {
+					continue
+				}
+				items = append(items, copyBlock(itemMap, "text", rewrittenText))
+				continue
+			case "tool_result":
+				if rewrittenContent, ok := rewriteReminderContent(itemMap["content"], counter, ctx); ok {
+					changed = true
+					items = append(items, copyBlock(itemMap, "content", rewrittenContent))
+					continue
+				}
+			}
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			items = append(items, map[string]any{"type": "text", "text": "[system reminder removed]"})
+		}
+		return items, changed
+	}
+	return content, false
+}
+
+func rewriteReminderText(text string, counter TokenCounter, ctx *ConvertContext) string {
+	if !strings.Contains(text, "<system-reminder>") {
+		return text
+	}
+	return systemReminderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		replacement := ""
+		if reminderMode == "condense" {
+			replacement = condenseReminder(systemReminderPattern.FindStringSubmatch(match)[1])
+		}
+		ctx.Stats.Reminders++
+		ctx.Stats.ReminderTokens += counter.Count(match) - counter.Count(replacement)
+		return replacement
+	})
+}
+
+func copyBlock(block map[string]any, key string, value any) map[string]any {
+	copied := make(map[string]any, len(block))
+	for k, v := range block {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+func condenseReminder(body string) string {
+	body = strings.TrimSpace(body)
+	if line, _, found := strings.Cut(body, "\n"); found {
+		body = strings.TrimSpace(line) + " ..."
+	}
+	if len(body) > reminderChars {
+		cut := reminderChars
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		body = body[:cut] + " ..."
+	}
+	return "<system-reminder>" + body + "</system-reminder>\n"
+}
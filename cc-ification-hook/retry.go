@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	retryMaxAttempts = 1
+	retryBaseDelay   = time.Second
+	retryMaxDelay    = 30 * time.Second
+	retryJitter      = 0.2
+)
+
+func loadRetryConfig() {
+	data, err := os.ReadFile("retry.json")
+	if err != nil {
+		return
+	}
+	var config struct {
+		MaxAttempts int      `json:"max_attempts"`
+		BaseDelayMs int      `json:"base_delay_ms"`
+		MaxDelayMs  int      `json:"max_delay_ms"`
+		Jitter      *float64 `json:"jitter"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return
+	}
+	if config.MaxAttempts > 0 {
+		retryMaxAttempts = config.MaxAttempts
+	}
+	if config.BaseDelayMs > 0 {
+		retryBaseDelay = time.Duration(config.BaseDelayMs) * time.Millisecond
+	}
+	if config.MaxDelayMs > 0 {
+		retryMaxDelay = time.Duration(config.MaxDelayMs) * time.Millisecond
+	}
+	if config.Jitter != nil && *config.Jitter >= 0 {
+		retryJitter = *config.Jitter
+	}
+	fmt.Println("[✓] Loaded retry.json")
+}
+
+func sendWithRetry(r *http.Request, route *Route, result *ConvertResult) (*http.Response, *Backend, *ConvertResult, error) {
+	for attempt := 1; ; attempt++ {
+		resp, backend, sent, err := sendToRoute(r, route, result)
+		if attempt >= retryMaxAttempts || r.Context().Err() != nil {
+			return resp, backend, sent, err
+		}
+
+		var reason string
+		var delay time.Duration
+		if err != nil {
+			reason = err.Error()
+			delay = backoffDelay(attempt)
+		} else if isRetryableStatus(resp.StatusCode) {
+			reason = fmt.Sprintf("HTTP %d", resp.StatusCode)
+			delay = backoffDelay(attempt)
+			if hinted, ok := retryAfterDelay(resp.Header); ok {
+				if hinted > retryMaxDelay {
+					addLog(fmt.Sprintf("[Retry] %s: upstream asks to wait %s, giving up", route.Name, hinted.Round(time.Second)))
+					return resp, backend, sent, nil
+				}
+				delay = hinted
+			}
+		} else {
+			return resp, backend, sent, nil
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		addLog(fmt.Sprintf("[Retry] %s: attempt %d/%d in %s (%s)", route.Name, attempt+1, retryMaxAttempts, delay.Round(time.Millisecond), reason))
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return nil, backend, sent, r.Context().Err()
+		}
+	}
+}
+
+func backoffDelay(attempt int) time.Duration {
+	delay := float64(retryBaseDelay) * math.Pow(2, float64(attempt-1))
+	if delay > float64(retryMaxDelay) {
+		delay = float64(retryMaxDelay)
+	}
+	if retryJitter > 0 {
+		delay *= 1 + retryJitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+func retryAfterDelay(header http.Header) (time.Duration, bool) {
+	var delay time.Duration
+	found := false
+
+	if value := header.Get("Retry-After"); value != "" {
+		if d, ok := parseResetValue(value); ok {
+			delay, found = d, true
+		} else if t, err := http.ParseTime(value); err == nil {
+			delay, found = time.Until(t), true
+		}
+	}
+
+	for name, values := range header {
+		if !strings.HasPrefix(strings.ToLower(name), "x-ratelimit-reset") || len(values) == 0 {
+			continue
+		}
+		if d, ok := parseResetValue(values[0]); ok && d > delay {
+			delay, found = d, true
+		}
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, found
+}
+
+func parseResetValue(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds > 1e9 {
+			return time.Until(time.Unix(int64(seconds), 0)), true
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	routes             []*Route
+	defaultRoute       *Route
+	multimodalRoute    *Route
+	routeRequests      = make(map[string]int64)
+	routeActiveBackend = make(map[string]string)
+	lastRouteName      string
+	failureThreshold   = 3
+	backendCooldown    = 30 * time.Second
+	backendTimeout     time.Duration
+)
+
+func loadRoutesConfig() {
+	data, err := os.ReadFile("routes.json")
+	if err != nil {
+		return
+	}
+	var config struct {
+		Routes           []*Route `json:"routes"`
+		FailureThreshold int      `json:"failure_threshold"`
+		CooldownSeconds  int      `json:"cooldown_seconds"`
+		TimeoutSeconds   int      `json:"timeout_seconds"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return
+	}
+	if config.FailureThreshold > 0 {
+		failureThreshold = config.FailureThreshold
+	}
+	if config.CooldownSeconds > 0 {
+		backendCooldown = time.Duration(config.CooldownSeconds) * time.Second
+	}
+	if config.TimeoutSeconds > 0 {
+		backendTimeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+	for _, route := range config.Routes {
+		if route == nil || route.Match == "" {
+			continue
+		}
+		initRouteBackends(route)
+		if len(route.Backends) == 0 {
+			continue
+		}
+		if route.Name == "" {
+			route.Name = route.Match
+		}
+		routes = append(routes, route)
+	}
+	if len(routes) > 0 {
+		fmt.Printf("[✓] Loaded routes.json (%d routes)\n", len(routes))
+	}
+}
+
+func initRouteBackends(route *Route) {
+	if len(route.Backends) == 0 && route.URL != "" {
+		route.Backends = []*Backend{{URL: route.URL}}
+	}
+	var backends []*Backend
+	for _, backend := range route.Backends {
+		if backend == nil || backend.URL == "" {
+			continue
+		}
+		backend.URL = strings.TrimRight(backend.URL, "/")
+		if backend.APIKey == "" {
+			backend.APIKey = route.APIKey
+		}
+		if backend.Model == "" {
+			backend.Model = route.Model
+		}
+		backends = append(backends, backend)
+	}
+	route.Backends = backends
+	if len(backends) > 0 {
+		route.URL = backends[0].URL
+	}
+}
+
+func initDefaultRoutes() {
+	defaultRoute = &Route{
+		Name:   "default",
+		Match:  "*",
+		URL:    backendURL,
+		APIKey: backendAPIKey,
+		Model:  backendModel,
+	}
+	initRouteBackends(defaultRoute)
+
+	if multimodalURL != "" {
+		multimodalRoute = &Route{
+			Name:   "multimodal",
+			Match:  "[image]",
+			URL:    multimodalURL,
+			APIKey: multimodalAPIKey,
+			Model:  multimodalModel,
+		}
+		initRouteBackends(multimodalRoute)
+	}
+}
+
+func allRoutes() []*Route {
+	all := append(append([]*Route{}, routes...), defaultRoute)
+	if multimodalRoute != nil {
+		all = append(all, multimodalRoute)
+	}
+	return all
+}
+
+func resolveRoute(model string) *Route {
+	for _, route := range routes {
+		if route.Match == model {
+			return route
+		}
+	}
+	for _, route := range routes {
+		if matched, _ := path.Match(route.Match, model); matched {
+			return route
+		}
+	}
+	return defaultRoute
+}
+
+func recordRouteRequest(route *Route, originalModel string) {
+	statsMu.Lock()
+	routeRequests[route.Name]++
+	lastRouteName = route.Name
+	statsMu.Unlock()
+
+	if len(routes) > 0 {
+		target := route.Model
+		if target == "" {
+			target = originalModel
+		}
+		addLog(fmt.Sprintf("[Route] %s -> %s (%s)", originalModel, route.Name, target))
+	}
+}
+
+func recordActiveBackend(route *Route, backend *Backend) {
+	statsMu.Lock()
+	routeActiveBackend[route.Name] = backend.URL
+	statsMu.Unlock()
+}
+
+func routeStatus() []map[string]any {
+	statsMu.RLock()
+	defer statsMu.RUnlock()
+
+	var result []map[string]any
+	for _, route := range allRoutes() {
+		if route == nil {
+			continue
+		}
+		var backends []map[string]any
+		for _, backend := range route.Backends {
+			backends = append(backends, backend.status())
+		}
+		result = append(result, map[string]any{
+			"name":          route.Name,
+			"match":         route.Match,
+			"url":           route.URL,
+			"model":         route.Model,
+			"interceptor":   route.Interceptor,
+			"requests":      routeRequests[route.Name],
+			"activeBackend": routeActiveBackend[route.Name],
+			"backends":      backends,
+		})
+	}
+	return result
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	summaryConcurrency      = 4
+	maxQueuedSummaries      = 256
+	maxSummaryInputChars    = 60000
+	defaultSummaryMinChars  = 200
+	defaultSummaryMaxTokens = 300
+	compressedPlaceholder   = "[compressed]"
+)
+
+const summarySystemPrompt = "You compress tool output for a coding agent's conversation history. " +
+	"Summarize the tool result in at most a few sentences. Keep file paths, symbol names, error messages, " +
+	"test names, counts and any values the agent may need later. Do not add commentary."
+
+var (
+	summaryModel    *AuxModel
+	summaryMinChars = defaultSummaryMinChars
+	summaryCache    = newDiskCache("summaries")
+	unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+	summarySlots    = make(chan struct{}, summaryConcurrency)
+	queuedSummaries = make(map[string]bool)
+	queuedSummaryMu sync.Mutex
+)
+
+func loadSummarizeConfig() {
+	data, err := os.ReadFile("summarize.json")
+	if err != nil {
+		return
+	}
+	var config struct {
+		URL       string `json:"url"`
+		APIType   string `json:"api_type"`
+		APIKey    string `json:"api_key"`
+		Model     string `json:"model"`
+		MaxTokens int    `json:"max_tokens"`
+		MinChars  *int   `json:"min_chars"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return
+	}
+	if config.URL == "" || config.APIKey == "" || config.Model == "" {
+		return
+	}
+	summaryModel = &AuxModel{
+		URL:       strings.TrimRight(config.URL, "/"),
+		APIType:   config.APIType,
+		APIKey:    config.APIKey,
+		Model:     config.Model,
+		MaxTokens: config.MaxTokens,
+	}
+	if summaryModel.APIType == "" {
+		summaryModel.APIType = "openai"
+	}
+	if summaryModel.MaxTokens <= 0 {
+		summaryModel.MaxTokens = defaultSummaryMaxTokens
+	}
+	if config.MinChars != nil && *config.MinChars >= 0 {
+		summaryMinChars = *config.MinChars
+	}
+	fmt.Println("[✓] Loaded summarize.json")
+}
+
+func summarizeCompressedResults(messages []AnthropicMessage, start, boundary int, plan *budgetPlan, ctx *ConvertContext) {
+	if summaryModel == nil || ctx.Quiet || ctx.Aggressive {
+		return
+	}
+
+	toolCalls := make(map[string]map[string]any)
+	for _, msg := range messages[start:] {
+		content, ok := msg.Content.([]any)
+		if !ok || msg.Role != "assistant" {
+			continue
+		}
+		for _, block := range content {
+			if blockMap, ok := block.(map[string]any); ok && blockMap["type"] == "tool_use" {
+				id, _ := blockMap["id"].(string)
+				toolCalls[id] = blockMap
+			}
+		}
+	}
+
+	queued := 0
+	for i := start; i < len(messages); i++ {
+		content, ok := messages[i].Content.([]any)
+		if !ok || messages[i].Role != "user" {
+			continue
+		}
+		for _, block := range content {
+			blockMap, ok := block.(map[string]any)
+			if !ok || blockMap["type"] != "tool_result" {
+				continue
+			}
+			id, _ := blockMap["tool_use_id"].(string)
+			if i >= boundary && (plan == nil || !plan.toolResults[id]) {
+				continue
+			}
+			if policy := ctx.resultPolicy(id); policy != "" && policy != "summarize" {
+				continue
+			}
+			text := toolResultText(blockMap["content"])
+			if len(text) < summaryMinChars {
+				continue
+			}
+			if _, ok := cachedSummary(id, text); ok {
+				continue
+			}
+			if queueSummary(id, text, toolCalls[id]) {
+				queued++
+			}
+		}
+	}
+	if queued > 0 {
+		addLog(fmt.Sprintf("[Summarize] %d tool results queued, sent as %s until summarized", queued, compressedPlaceholder))
+	}
+}
+
+func queueSummary(id, text string, toolCall map[string]any) bool {
+	key := summaryKey(id, text)
+	queuedSummaryMu.Lock()
+	if queuedSummaries[key] || len(queuedSummaries) >= maxQueuedSummaries {
+		queuedSummaryMu.Unlock()
+		return false
+	}
+	queuedSummaries[key] = true
+	queuedSummaryMu.Unlock()
+
+	go func() {
+		summarySlots <- struct{}{}
+		defer func() {
+			<-summarySlots
+			queuedSummaryMu.Lock()
+			delete(queuedSummaries, key)
+			queuedSummaryMu.Unlock()
+		}()
+
+		summary, err := callAuxModel(summaryModel, summarySystemPrompt, summaryPrompt(toolCall, text))
+		if err != nil {
+			addLog(fmt.Sprintf("[✗] Summarize %s failed: %v", id, err))
+			return
+		}
+		storeSummary(id, text, summary)
+	}()
+	return true
+}
+
+func compressedToolResult(toolUseID string, content any, ctx *ConvertContext) string {
+	switch ctx.resultPolicy(toolUseID) {
+	case "drop":
+		return compressedPlaceholder
+	case "truncate":
+		text := toolResultText(content)
+		if text == "" {
+			return compressedPlaceholder
+		}
+		return truncateLines(text, toolPolicies[ctx.ToolNames[toolUseID]].Lines)
+	}
+	if summaryModel == nil {
+		return compressedPlaceholder
+	}
+	text := toolResultText(content)
+	if len(text) < summaryMinChars {
+		if text == "" {
+			return compressedPlaceholder
+		}
+		return text
+	}
+	if summary, ok := cachedSummary(toolUseID, text); ok {
+		return "[summarized] " + summary
+	}
+	return compressedPlaceholder
+}
+
+func summaryPrompt(toolCall map[string]any, text string) string {
+	if len(text) > maxSummaryInputChars {
+		text = text[:maxSummaryInputChars] + "\n... (truncated)"
+	}
+	var sb strings.Builder
+	if toolCall != nil {
+		name, _ := toolCall["name"].(string)
+		input, _ := json.Marshal(toolCall["input"])
+		sb.WriteString(fmt.Sprintf("Tool call: %s %s\n\n", name, input))
+	}
+	sb.WriteString("Tool result:\n")
+	sb.WriteString(text)
+	return sb.String()
+}
+
+func toolResultText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, item := range v {
+			itemMap, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch itemMap["type"] {
+			case "text":
+				if text, ok := itemMap["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			case "image":
+				texts = append(texts, "[image]")
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+func summaryKey(toolUseID, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return unsafeFileChars.ReplaceAllString(toolUseID, "_") + "_" + hex.EncodeToString(sum[:8]) + ".txt"
+}
+
+func cachedSummary(toolUseID, text string) (string, bool) {
+	return summaryCache.Get(summaryKey(toolUseID, text))
+}
+
+func storeSummary(toolUseID, text, summary string) {
+	summaryCache.Put(summaryKey(toolUseID, text), summary)
+}
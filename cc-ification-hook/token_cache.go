@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+const (
+	maxTokenCountCacheSize = 4096
+	maxCountCacheDrift     = 2000
+)
+
+var (
+	tokenCountCache   = make(map[string]int)
+	tokenCountCacheMu sync.Mutex
+)
+
+func prefixHashes[T any](seed any, messages []T) []string {
+	h := sha256.New()
+	seedData, _ := json.Marshal(seed)
+	h.Write(seedData)
+	prev := h.Sum(nil)
+
+	hashes := make([]string, len(messages))
+	for i, msg := range messages {
+		data, _ := json.Marshal(msg)
+		h.Reset()
+		h.Write(prev)
+		h.Write(data)
+		prev = h.Sum(nil)
+		hashes[i] = hex.EncodeToString(prev)
+	}
+	return hashes
+}
+
+func longestCachedPrefix(hashes []string) (int, int) {
+	tokenCountCacheMu.Lock()
+	defer tokenCountCacheMu.Unlock()
+	for i := len(hashes) - 1; i >= 0; i-- {
+		if count, ok := tokenCountCache[hashes[i]]; ok {
+			return i, count
+		}
+	}
+	return -1, 0
+}
+
+func storeTokenCount(hash string, count int) {
+	tokenCountCacheMu.Lock()
+	defer tokenCountCacheMu.Unlock()
+	if len(tokenCountCache) >= maxTokenCountCacheSize {
+		tokenCountCache = make(map[string]int)
+	}
+	tokenCountCache[hash] = count
+}
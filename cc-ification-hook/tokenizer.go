@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	maxTokenizerWordBytes = 256
+	maxTokenizerCacheSize = 100000
+)
+
+var (
+	defaultSplitPattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+	byteEncoder         = buildByteEncoder()
+	tokenCounters       = make(map[string]TokenCounter)
+	tokenCountersMu     sync.Mutex
+)
+
+var fallbackTokenRatios = []struct {
+	pattern       string
+	bytesPerToken float64
+}{
+	{"claude", 3.5},
+	{"glm", 3.6},
+	{"qwen", 3.7},
+	{"deepseek", 3.7},
+	{"kimi", 3.7},
+	{"moonshot", 3.7},
+	{"llama", 3.6},
+	{"mistral", 3.5},
+	{"gpt", 4.0},
+	{"gemini", 4.0},
+}
+
+type TokenCounter interface {
+	Count(text string) int
+}
+
+type ratioCounter struct {
+	bytesPerToken float64
+}
+
+func (c ratioCounter) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(math.Ceil(float64(len(text)) / c.bytesPerToken))
+}
+
+type Tokenizer struct {
+	vocab        map[string]int
+	ranks        map[string]int
+	byteLevel    bool
+	metaspace    bool
+	byteFallback bool
+	ignoreMerges bool
+	split        *regexp.Regexp
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+func tokenCounterForModel(model string) TokenCounter {
+	tokenCountersMu.Lock()
+	defer tokenCountersMu.Unlock()
+
+	if counter, ok := tokenCounters[model]; ok {
+		return counter
+	}
+	counter := loadTokenCounter(model)
+	tokenCounters[model] = counter
+	return counter
+}
+
+func loadTokenCounter(model string) TokenCounter {
+	for _, path := range tokenizerPaths(model) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		tokenizer, err := loadTokenizer(path)
+		if err != nil {
+			addLog(fmt.Sprintf("[✗] Failed to load tokenizer %s: %v", path, err))
+			continue
+		}
+		addLog(fmt.Sprintf("[✓] Loaded tokenizer %s for %s", path, model))
+		return tokenizer
+	}
+	return ratioCounter{bytesPerToken: fallbackBytesPerToken(model)}
+}
+
+func tokenizerPaths(model string) []string {
+	var paths []string
+	if model != "" && !strings.Contains(model, "..") {
+		paths = append(paths,
+			filepath.Join("tokenizers", model+".json"),
+			filepath.Join("tokenizers", model, "tokenizer.json"),
+		)
+	}
+	return append(paths, "tokenizer.json")
+}
+
+func fallbackBytesPerToken(model string) float64 {
+	lower := strings.ToLower(model)
+	for _, ratio := range fallbackTokenRatios {
+		if strings.Contains(lower, ratio.pattern) {
+			return ratio.bytesPerToken
+		}
+	}
+	return 4.0
+}
+
+func loadTokenizer(path string) (*Tokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Normalizer   any `json:"normalizer"`
+		PreTokenizer any `json:"pre_tokenizer"`
+		Decoder      any `json:"decoder"`
+		Model        struct {
+			Type         string            `json:"type"`
+			Vocab        json.RawMessage   `json:"vocab"`
+			Merges       []json.RawMessage `json:"merges"`
+			ByteFallback bool              `json:"byte_fallback"`
+			IgnoreMerges bool              `json:"ignore_merges"`
+		} `json:"model"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Model.Type != "BPE" && !(file.Model.Type == "" && len(file.Model.Merges) > 0) {
+		return nil, fmt.Errorf("unsupported tokenizer model type %q", file.Model.Type)
+	}
+
+	t := &Tokenizer{
+		ranks:        make(map[string]int, len(file.Model.Merges)),
+		byteFallback: file.Model.ByteFallback,
+		ignoreMerges: file.Model.IgnoreMerges,
+		split:        defaultSplitPattern,
+		cache:        make(map[string]int),
+	}
+	if err := json.Unmarshal(file.Model.Vocab, &t.vocab); err != nil {
+		return nil, fmt.Errorf("invalid vocab: %v", err)
+	}
+
+	for rank, raw := range file.Model.Merges {
+		var left, right string
+		var pair []string
+		var merge string
+		if err := json.Unmarshal(raw, &merge); err == nil {
+			parts := strings.SplitN(merge, " ", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			left, right = parts[0], parts[1]
+		} else if err := json.Unmarshal(raw, &pair); err == nil && len(pair) == 2 {
+			left, right = pair[0], pair[1]
+		} else {
+			continue
+		}
+		key := left + "\x00" + right
+		if _, exists := t.ranks[key]; !exists {
+			t.ranks[key] = rank
+		}
+	}
+
+	t.byteLevel = findTokenizerComponent(file.PreTokenizer, "ByteLevel") != nil ||
+		findTokenizerComponent(file.Decoder, "ByteLevel") != nil
+	t.metaspace = !t.byteLevel && (findTokenizerComponent(file.PreTokenizer, "Metaspace") != nil ||
+		findTokenizerComponent(file.Normalizer, "Replace") != nil ||
+		findTokenizerComponent(file.Decoder, "Metaspace") != nil)
+
+	if split := findTokenizerComponent(file.PreTokenizer, "Split"); split != nil {
+		if pattern, ok := split["pattern"].(map[string]any); ok {
+			if expr, ok := pattern["Regex"].(string); ok {
+				if re, err := regexp.Compile(expr); err == nil {
+					t.split = re
+				} else {
+					addLog(fmt.Sprintf("[✗] Tokenizer %s: split pattern not supported by Go regexp (%v), using the default pattern, counts are approximate", path, err))
+				}
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func findTokenizerComponent(v any, componentType string) map[string]any {
+	switch t := v.(type) {
+	case map[string]any:
+		if t["type"] == componentType {
+			return t
+		}
+		for _, child := range t {
+			if found := findTokenizerComponent(child, componentType); found != nil {
+				return found
+			}
+		}
+	case []any:
+		for _, child := range t {
+			if found := findTokenizerComponent(child, componentType); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Tokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	total := 0
+	if t.metaspace {
+		text = "▁" + strings.ReplaceAll(text, " ", "▁")
+		start := 0
+		for i := range text {
+			if i > start && strings.HasPrefix(text[i:], "▁") {
+				total += t.countWord(text[start:i])
+				start = i
+			}
+		}
+		return total + t.countWord(text[start:])
+	}
+
+	for _, word := range t.split.FindAllString(text, -1) {
+		total += t.countWord(word)
+	}
+	return total
+}
+
+func (t *Tokenizer) countWord(word string) int {
+	if len(word) > maxTokenizerWordBytes {
+		total := 0
+		for len(word) > 0 {
+			end := maxTokenizerWordBytes
+			if end > len(word) {
+				end = len(word)
+			}
+			for end < len(word) && !utf8.RuneStart(word[end]) {
+				end++
+			}
+			total += t.countWord(word[:end])
+			word = word[end:]
+		}
+		return total
+	}
+
+	t.mu.Lock()
+	count, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return count
+	}
+
+	count = t.bpe(word)
+
+	t.mu.Lock()
+	if len(t.cache) >= maxTokenizerCacheSize {
+		t.cache = make(map[string]int)
+	}
+	t.cache[word] = count
+	t.mu.Unlock()
+	return count
+}
+
+func (t *Tokenizer) bpe(word string) int {
+	var symbols []string
+	if t.byteLevel {
+		for i := 0; i < len(word); i++ {
+			symbols = append(symbols, byteEncoder[word[i]])
+		}
+	} else {
+		for _, r := range word {
+			symbols = append(symbols, string(r))
+		}
+	}
+
+	if t.ignoreMerges {
+		if _, ok := t.vocab[strings.Join(symbols, "")]; ok {
+			return 1
+		}
+	}
+
+	for len(symbols) > 1 {
+		best := -1
+		bestRank := math.MaxInt
+		for i := 0; i < len(symbols)-1; i++ {
+			if rank, ok := t.ranks[symbols[i]+"\x00"+symbols[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	if t.byteLevel {
+		return len(symbols)
+	}
+
+	count := 0
+	for _, symbol := range symbols {
+		if _, ok := t.vocab[symbol]; ok || !t.byteFallback {
+			count++
+		} else {
+			count += len(symbol)
+		}
+	}
+	return count
+}
+
+func buildByteEncoder() [256]string {
+	var encoder [256]string
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			encoder[b] = string(rune(b))
+		} else {
+			encoder[b] = string(rune(256 + n))
+			n++
+		}
+	}
+	return encoder
+}
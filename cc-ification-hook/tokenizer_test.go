@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenizerGoldenCounts(t *testing.T) {
+	tests := []struct {
+		file string
+		text string
+		want int
+	}{
+		{"bytelevel_tokenizer.json", "", 0},
+		{"bytelevel_tokenizer.json", "hello", 1},
+		{"bytelevel_tokenizer.json", "hello world", 3},
+		{"bytelevel_tokenizer.json", "hello hello", 3},
+		{"bytelevel_tokenizer.json", "hello\n\nworld", 6},
+		{"bytelevel_tokenizer.json", "12345", 5},
+		{"bytelevel_tokenizer.json", "héllo", 5},
+		{"bytelevel_tokenizer.json", strings.Repeat("a", 300), 300},
+		{"split_tokenizer.json", "hello world", 5},
+		{"lookahead_tokenizer.json", "hello world", 3},
+		{"metaspace_tokenizer.json", "hi", 1},
+		{"metaspace_tokenizer.json", "hi hé", 4},
+	}
+
+	for _, tt := range tests {
+		tokenizer, err := loadTokenizer(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatalf("loadTokenizer(%s): %v", tt.file, err)
+		}
+		if got := tokenizer.Count(tt.text); got != tt.want {
+			t.Errorf("%s: Count(%q) = %d, want %d", tt.file, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizerLogsUnsupportedSplitPattern(t *testing.T) {
+	tokenizer, err := loadTokenizer(filepath.Join("testdata", "lookahead_tokenizer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenizer.split != defaultSplitPattern {
+		t.Errorf("split = %v, want default pattern", tokenizer.split)
+	}
+
+	logsMu.Lock()
+	defer logsMu.Unlock()
+	for _, line := range logs {
+		if strings.Contains(line, "lookahead_tokenizer.json") && strings.Contains(line, "split pattern not supported") {
+			return
+		}
+	}
+	t.Errorf("fallback to the default split pattern was not logged")
+}
+
+func TestTokenizerRejectsUnsupportedModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	if err := os.WriteFile(path, []byte(`{"model": {"type": "WordPiece", "vocab": {"a": 0}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTokenizer(path); err == nil {
+		t.Error("expected an error for a WordPiece tokenizer")
+	}
+}
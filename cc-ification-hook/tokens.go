@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	messageOverheadTokens = 4
+	imageTokenEstimate    = 1200
+)
+
+func countRequestTokens(req *AnthropicRequest) (int, error) {
+	route := resolveRoute(req.Model)
+	ctx := &ConvertContext{
+		Route:         route,
+		UseMultimodal: useMultimodalRoute(req),
+		Quiet:         true,
+	}
+	ctx.BackendURL = ctx.servingRoute().primaryURL()
+	ctx.Interceptor = CreateInterceptor(route, ctx.BackendURL)
+	openaiReq, err := convertAnthropicToOpenAI(req, ctx)
+	if err != nil {
+		return 0, err
+	}
+	return estimateOpenAIRequestTokens(openaiReq), nil
+}
+
+func estimateOpenAIRequestTokens(req *OpenAIRequest) int {
+	if req == nil {
+		return 0
+	}
+	counter := tokenCounterForModel(req.Model)
+	hashes := prefixHashes([]any{"openai", req.Model, req.Tools}, req.Messages)
+
+	start, total := longestCachedPrefix(hashes)
+	if start < 0 && len(req.Tools) > 0 {
+		data, _ := json.Marshal(req.Tools)
+		total = counter.Count(string(data))
+	}
+	for i := start + 1; i < len(req.Messages); i++ {
+		total += estimateOpenAIMessageTokens(counter, req.Messages[i])
+		storeTokenCount(hashes[i], total)
+	}
+	return total
+}
+
+func estimateAnthropicMessageTokens(counter TokenCounter, msg AnthropicMessage) int {
+	return messageOverheadTokens + estimateAnthropicContentTokens(counter, msg.Content)
+}
+
+func estimateAnthropicContentTokens(counter TokenCounter, content any) int {
+	switch v := content.(type) {
+	case string:
+		return counter.Count(v)
+	case []any:
+		total := 0
+		for _, block := range v {
+			blockMap, ok := block.(map[string]any)
+			if !ok {
+				continue
+			}
+			switch blockMap["type"] {
+			case "text":
+				text, _ := blockMap["text"].(string)
+				total += counter.Count(text)
+			case "thinking":
+				thinking, _ := blockMap["thinking"].(string)
+				total += counter.Count(thinking)
+			case "image":
+				total += imageTokenEstimate
+			case "tool_use":
+				name, _ := blockMap["name"].(string)
+				input, _ := json.Marshal(blockMap["input"])
+				total += counter.Count(name) + counter.Count(string(input))
+			case "tool_result":
+				total += estimateAnthropicContentTokens(counter, blockMap["content"])
+			default:
+				data, _ := json.Marshal(blockMap)
+				total += counter.Count(string(data))
+			}
+		}
+		return total
+	case nil:
+		return 0
+	}
+	data, _ := json.Marshal(content)
+	return counter.Count(string(data))
+}
+
+func estimateOpenAIMessageTokens(counter TokenCounter, msg OpenAIMessage) int {
+	total := messageOverheadTokens
+	total += estimateContentTokens(counter, msg.Content)
+	total += counter.Count(msg.ReasoningContent)
+	for _, tc := range msg.ToolCalls {
+		total += counter.Count(tc.Function.Name) + counter.Count(tc.Function.Arguments)
+	}
+	return total
+}
+
+func estimateContentTokens(counter TokenCounter, content any) int {
+	switch v := content.(type) {
+	case string:
+		return counter.Count(v)
+	case []OpenAIContentPart:
+		total := 0
+		for _, part := range v {
+			total += estimatePartTokens(counter, part)
+		}
+		return total
+	case []any:
+		total := 0
+		for _, item := range v {
+			switch p := item.(type) {
+			case OpenAIContentPart:
+				total += estimatePartTokens(counter, p)
+			case string:
+				total += counter.Count(p)
+			default:
+				data, _ := json.Marshal(p)
+				total += counter.Count(string(data))
+			}
+		}
+		return total
+	case nil:
+		return 0
+	}
+	data, _ := json.Marshal(content)
+	return counter.Count(string(data))
+}
+
+func estimatePartTokens(counter TokenCounter, part OpenAIContentPart) int {
+	if part.ImageURL != nil {
+		return imageTokenEstimate
+	}
+	if part.File != nil {
+		return counter.Count(pdfText(strings.TrimPrefix(part.File.FileData, "data:application/pdf;base64,"), true))
+	}
+	return counter.Count(part.Text)
+}
+
+func scaleTokens(tokens int) int {
+	return int(float64(tokens) * tokenScaleFactor)
+}
+
+func cacheTokenDetails(usage *OpenAIUsage) (cacheRead int, cacheCreation int) {
+	if usage == nil {
+		return 0, 0
+	}
+	cacheRead = usage.PromptCacheHitTokens
+	if usage.PromptTokensDetails != nil {
+		if usage.PromptTokensDetails.CachedTokens > 0 {
+			cacheRead = usage.PromptTokensDetails.CachedTokens
+		}
+		cacheCreation = usage.PromptTokensDetails.CacheCreationInputTokens
+		if cacheCreation == 0 {
+			cacheCreation = usage.PromptTokensDetails.CacheWriteTokens
+		}
+	}
+	return cacheRead, cacheCreation
+}
+
+func uncachedInputTokens(usage *OpenAIUsage) int {
+	if usage == nil {
+		return 0
+	}
+	cacheRead, cacheCreation := cacheTokenDetails(usage)
+	input := usage.PromptTokens - cacheRead - cacheCreation
+	if input < 0 {
+		input = 0
+	}
+	return input
+}
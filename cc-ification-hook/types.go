@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
 
 type AnthropicMessage struct {
 	Role    string `json:"role"`
@@ -42,10 +46,17 @@ type ImageURL struct {
 	URL string `json:"url"`
 }
 
+type FilePart struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data"`
+}
+
 type OpenAIContentPart struct {
-	Type     string    `json:"type"`
-	Text     string    `json:"text,omitempty"`
-	ImageURL *ImageURL `json:"image_url,omitempty"`
+	Type         string    `json:"type"`
+	Text         string    `json:"text,omitempty"`
+	ImageURL     *ImageURL `json:"image_url,omitempty"`
+	File         *FilePart `json:"file,omitempty"`
+	CacheControl any       `json:"cache_control,omitempty"`
 }
 
 type ToolCallFunction struct {
@@ -119,23 +130,27 @@ type OpenAIChoice struct {
 }
 
 type OpenAIPromptTokenDetails struct {
-	CachedTokens int `json:"cached_tokens,omitempty"`
+	CachedTokens             int `json:"cached_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheWriteTokens         int `json:"cache_write_tokens,omitempty"`
 }
 
 type OpenAIUsage struct {
-	PromptTokens        int                       `json:"prompt_tokens"`
-	CompletionTokens    int                       `json:"completion_tokens"`
-	TotalTokens         int                       `json:"total_tokens"`
-	PromptTokensDetails *OpenAIPromptTokenDetails `json:"prompt_tokens_details,omitempty"`
+	PromptTokens         int                       `json:"prompt_tokens"`
+	CompletionTokens     int                       `json:"completion_tokens"`
+	TotalTokens          int                       `json:"total_tokens"`
+	PromptTokensDetails  *OpenAIPromptTokenDetails `json:"prompt_tokens_details,omitempty"`
+	PromptCacheHitTokens int                       `json:"prompt_cache_hit_tokens,omitempty"`
 }
 
 type OpenAIResponse struct {
-	ID      string         `json:"id"`
-	Object  string         `json:"object"`
-	Created int64          `json:"created"`
-	Model   string         `json:"model"`
-	Choices []OpenAIChoice `json:"choices"`
-	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+	ID      string          `json:"id"`
+	Object  string          `json:"object"`
+	Created int64           `json:"created"`
+	Model   string          `json:"model"`
+	Choices []OpenAIChoice  `json:"choices"`
+	Usage   *OpenAIUsage    `json:"usage,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
 }
 
 type OpenAINonStreamMessage struct {
@@ -163,9 +178,10 @@ type OpenAINonStreamResponse struct {
 }
 
 type AnthropicUsage struct {
-	InputTokens          int `json:"input_tokens"`
-	OutputTokens         int `json:"output_tokens"`
-	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
 }
 
 type AnthropicResponse struct {
@@ -193,6 +209,7 @@ type StreamState struct {
 	Interceptor      Interceptor
 	StartTime        time.Time
 	FirstTokenTime   time.Time
+	InputTokens      int
 }
 
 type ToolCallState struct {
@@ -208,9 +225,15 @@ type CountTokensResponse struct {
 }
 
 type CompressionStats struct {
-	ThinkingBlocks int
-	ToolCalls      int
-	ToolResults    int
+	ThinkingBlocks  int
+	ToolCalls       int
+	ToolResults     int
+	Deduplicated    int
+	Truncated       int
+	Reminders       int
+	ReminderTokens  int
+	EstimatedTokens int
+	BudgetTokens    int
 }
 
 type ConvertResult struct {
@@ -218,6 +241,60 @@ type ConvertResult struct {
 	OpenAIRequest    *OpenAIRequest
 	UseMultimodal    bool
 	IsAnthropic      bool
+	Route            *Route
+	Interceptor      Interceptor
+	BackendURL       string
+	Source           *AnthropicRequest
+	Aggressive       bool
+}
+
+type ConvertContext struct {
+	Route         *Route
+	BackendURL    string
+	Interceptor   Interceptor
+	UseMultimodal bool
+	PromptCache   bool
+	Quiet         bool
+	Aggressive    bool
+	ToolNames     map[string]string
+	Stats         CompressionStats
+}
+
+type ToolPolicy struct {
+	Result string `json:"result"`
+	Input  string `json:"input"`
+	Lines  int    `json:"lines"`
+}
+
+type AuxModel struct {
+	URL       string
+	APIType   string
+	APIKey    string
+	Model     string
+	MaxTokens int
+}
+
+type Route struct {
+	Name         string     `json:"name"`
+	Match        string     `json:"match"`
+	URL          string     `json:"url"`
+	APIKey       string     `json:"api_key"`
+	Model        string     `json:"model"`
+	Interceptor  string     `json:"interceptor"`
+	CacheControl *bool      `json:"cache_control"`
+	PDF          string     `json:"pdf"`
+	Backends     []*Backend `json:"backends"`
+}
+
+type Backend struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+	Model  string `json:"model"`
+
+	mu             sync.Mutex
+	failures       int
+	unhealthyUntil time.Time
+	lastError      string
 }
 
 type RequestMetrics struct {